@@ -2,19 +2,8 @@ package ability
 
 import (
 	"github.com/runningwild/jota/stats"
-	"sync"
 )
 
-var abilityId int
-var abilityIdMutex sync.Mutex
-
-func NextAbilityId() int {
-	abilityIdMutex.Lock()
-	defer abilityIdMutex.Unlock()
-	abilityId++
-	return abilityId
-}
-
 type NullCondition struct{}
 
 func (NullCondition) ModifyBase(base stats.Base) stats.Base {
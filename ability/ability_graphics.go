@@ -41,7 +41,7 @@ func (p *asplosionProc) Draw(src, obs game.Gid, game *game.Game) {
 	base.EnableShader("")
 }
 func (f *lightning) Draw(ent game.Ent, g *game.Game) {
-	if !f.draw {
+	if !f.Drawing {
 		return
 	}
 	gl.Disable(gl.TEXTURE_2D)
@@ -143,7 +143,7 @@ func (p *nitroProc) Draw(src, obs game.Gid, game *game.Game) {
 	base.EnableShader("")
 }
 func (p *pull) Draw(ent game.Ent, g *game.Game) {
-	if !p.draw {
+	if !p.Drawing {
 		return
 	}
 	player, ok := ent.(*game.PlayerEnt)
@@ -155,8 +155,8 @@ func (p *pull) Draw(ent game.Ent, g *game.Game) {
 	gl.Disable(gl.TEXTURE_2D)
 	v1 := player.Pos()
 	v2 := v1.Add(linear.Vec2{1000, 0})
-	v3 := v2.RotateAround(v1, player.Angle()-p.angle/2)
-	v4 := v2.RotateAround(v1, player.Angle()+p.angle/2)
+	v3 := v2.RotateAround(v1, player.Angle()-p.Angle/2)
+	v4 := v2.RotateAround(v1, player.Angle()+p.Angle/2)
 	gl.Begin(gl.LINES)
 	vs := []linear.Vec2{v3, v4, player.Pos()}
 	for i := range vs {
@@ -1,54 +1,54 @@
 package ability
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/game"
 	"github.com/runningwild/jota/stats"
 )
 
-func makeCloak(params map[string]float64) game.Ability {
+func makeCloak(id int, params map[string]float64) game.Ability {
 	var c cloak
-	c.id = NextAbilityId()
-	c.maxCloak = params["maxCloak"]
-	c.manaPerCloak = params["manaPerCloak"]
-	c.cloakPerTick = params["cloakPerTick"]
+	c.Id = id
+	c.MaxCloak = params["maxCloak"]
+	c.ManaPerCloak = params["manaPerCloak"]
+	c.CloakPerTick = params["cloakPerTick"]
 	return &c
 }
 
 func init() {
 	game.RegisterAbility("cloak", makeCloak)
-	gob.Register(&cloak{})
+	game.RegisterType(&cloak{})
+	game.RegisterType(&cloakProc{})
 }
 
 type cloak struct {
-	id int
+	Id int
 
 	// Params
-	maxCloak     float64
-	manaPerCloak float64
-	cloakPerTick float64
+	MaxCloak     float64
+	ManaPerCloak float64
+	CloakPerTick float64
 
-	on       bool
-	previous struct {
-		pressAmt float64
-		trigger  bool
+	On       bool
+	Previous struct {
+		PressAmt float64
+		Trigger  bool
 	}
 }
 
 func (c *cloak) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
 	player := ent.(*game.PlayerEnt)
-	if pressAmt == c.previous.pressAmt {
+	if pressAmt == c.Previous.PressAmt {
 		return
 	}
-	if !c.on {
-		c.on = pressAmt > 0
+	if !c.On {
+		c.On = pressAmt > 0
 	} else {
-		c.on = pressAmt == 0
+		c.On = pressAmt == 0
 	}
-	if c.on {
-		player.Processes[c.id] = &cloakProc{Gid: player.Gid, MaxCloak: c.maxCloak, ManaPerCloak: c.manaPerCloak, CloakPerTick: c.cloakPerTick}
+	if c.On {
+		player.Processes[c.Id] = &cloakProc{Gid: player.Gid, MaxCloak: c.MaxCloak, ManaPerCloak: c.ManaPerCloak, CloakPerTick: c.CloakPerTick}
 	} else {
-		delete(player.Processes, c.id)
+		delete(player.Processes, c.Id)
 	}
 }
 
@@ -1,30 +1,30 @@
 package control_point
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/ability"
 	"github.com/runningwild/jota/game"
 )
 
-func makeSpawnCreeps(params map[string]float64) game.Ability {
+func makeSpawnCreeps(id int, params map[string]float64) game.Ability {
 	var sc spawnCreeps
-	sc.id = ability.NextAbilityId()
+	sc.Id = id
 	return &sc
 }
 
 func init() {
 	game.RegisterAbility("spawnCreeps", makeSpawnCreeps)
-	gob.Register(&spawnCreeps{})
+	game.RegisterType(&spawnCreeps{})
+	game.RegisterType(&omniDrain{})
 }
 
 type spawnCreeps struct {
-	id      int
-	health  float64
-	damage  float64
-	trigger float64
-	mass    float64
-	cost    float64
-	fire    int
+	Id      int
+	Health  float64
+	Damage  float64
+	Trigger float64
+	Mass    float64
+	Cost    float64
+	Fire    int
 }
 
 // Typical process for draining all mana possible.
@@ -69,21 +69,21 @@ func (p *omniDrain) Dead() bool {
 func (sc *spawnCreeps) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
 	cp := ent.(*game.ControlPoint)
 	if pressAmt == 0 {
-		delete(cp.Processes, sc.id)
+		delete(cp.Processes, sc.Id)
 		return
 	}
-	_, ok := cp.Processes[sc.id].(*omniDrain)
+	_, ok := cp.Processes[sc.Id].(*omniDrain)
 	if !ok && cp.Controlled {
-		cp.Processes[sc.id] = &omniDrain{Gid: cp.Gid}
+		cp.Processes[sc.Id] = &omniDrain{Gid: cp.Gid}
 		return
 	}
 	if !cp.Controlled {
-		delete(cp.Processes, sc.id)
+		delete(cp.Processes, sc.Id)
 		return
 	}
-	if proc, _ := cp.Processes[sc.id].(*omniDrain); proc != nil && trigger {
+	if proc, _ := cp.Processes[sc.Id].(*omniDrain); proc != nil && trigger {
 		g.AddEnt(ent)
-		delete(cp.Processes, sc.id)
+		delete(cp.Processes, sc.Id)
 		creepCount := int(proc.Stored.Magnitude() / 300)
 		g.AddCreeps(cp.Pos(), creepCount, cp.Side(), map[string]interface{}{"target": cp.Targets[0]})
 	}
@@ -1,38 +1,34 @@
 package creep
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/ability"
 	"github.com/runningwild/jota/game"
 	"github.com/runningwild/jota/stats"
 	"github.com/runningwild/linear"
 )
 
-func makeAsplode(params map[string]float64) game.Ability {
+func makeAsplode(id int, params map[string]float64) game.Ability {
 	var a asplode
-	a.id = ability.NextAbilityId()
-	a.startRadius = params["startRadius"]
-	a.endRadius = params["endRadius"]
-	a.durationThinks = int(params["durationThinks"])
-	a.dps = params["dps"]
+	a.Id = id
+	a.StartRadius = params["startRadius"]
+	a.EndRadius = params["endRadius"]
+	a.DurationThinks = int(params["durationThinks"])
+	a.Dps = params["dps"]
 	return &a
 }
 
 func init() {
 	game.RegisterAbility("asplode", makeAsplode)
-	gob.Register(&asplode{})
+	game.RegisterType(&asplode{})
+	game.RegisterType(&asplosionProc{})
 }
 
 type asplode struct {
-	id             int
-	startRadius    float64
-	endRadius      float64
-	durationThinks int
-	dps            float64
-
-	// This is silly - but it's because otherwise gob might complain that nothing
-	// is exported.
-	Export struct{}
+	Id             int
+	StartRadius    float64
+	EndRadius      float64
+	DurationThinks int
+	Dps            float64
 }
 
 func (a *asplode) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
@@ -40,11 +36,12 @@ func (a *asplode) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bo
 		// Kill ent and put down explosion
 		ent.Suicide()
 		g.Processes = append(g.Processes, &asplosionProc{
-			StartRadius:    a.startRadius,
-			EndRadius:      a.endRadius,
-			DurationThinks: a.durationThinks,
-			Dps:            a.dps,
+			StartRadius:    a.StartRadius,
+			EndRadius:      a.EndRadius,
+			DurationThinks: a.DurationThinks,
+			Dps:            a.Dps,
 			Pos:            ent.Pos(),
+			Source:         ent.Id(),
 		})
 	}
 }
@@ -68,6 +65,9 @@ type asplosionProc struct {
 	Dps            float64
 	Pos            linear.Vec2
 	Killed         bool
+
+	// Gid of the creep that asploded.
+	Source game.Gid
 }
 
 func (p *asplosionProc) Supply(mana game.Mana) game.Mana {
@@ -78,7 +78,7 @@ func (p *asplosionProc) Think(g *game.Game) {
 	p.CurrentRadius = float64(p.NumThinks)/float64(p.DurationThinks)*(p.EndRadius-p.StartRadius) + p.StartRadius
 	for _, ent := range g.Ents {
 		if ent.Pos().Sub(p.Pos).Mag2() <= p.CurrentRadius*p.CurrentRadius {
-			ent.Stats().ApplyDamage(stats.Damage{stats.DamageFire, p.Dps})
+			ent.Stats().ApplyDamage(stats.Damage{Kind: stats.DamageFire, Amt: p.Dps, Source: string(p.Source), Ability: "asplode"})
 		}
 	}
 }
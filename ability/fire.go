@@ -1,7 +1,6 @@
 package ability
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/game"
 	"github.com/runningwild/jota/stats"
 	"github.com/runningwild/linear"
@@ -17,73 +16,74 @@ const (
 	fireRegionBack
 )
 
-func makeFire(params map[string]float64) game.Ability {
+func makeFire(id int, params map[string]float64) game.Ability {
 	var f fire
-	f.id = NextAbilityId()
+	f.Id = id
 	switch params["region"] {
 	case 1:
-		f.region = fireRegionFront
+		f.Region = fireRegionFront
 	case 2:
-		f.region = fireRegionFlank
+		f.Region = fireRegionFlank
 	case 3:
-		f.region = fireRegionBack
+		f.Region = fireRegionBack
 	default:
 		panic("Unexpected value for 'region' parameter of fire ability")
 	}
-	f.distToCenter = params["distToCenter"]
-	f.deviance = params["deviance"]
-	f.startRadius = params["startRadius"]
-	f.endRadius = params["endRadius"]
-	f.durationThinks = int(params["durationThinks"])
-	f.dps = params["dps"]
-	f.xps = params["xps"]
-	f.cost = params["cost"]
+	f.DistToCenter = params["distToCenter"]
+	f.Deviance = params["deviance"]
+	f.StartRadius = params["startRadius"]
+	f.EndRadius = params["endRadius"]
+	f.DurationThinks = int(params["durationThinks"])
+	f.Dps = params["dps"]
+	f.Xps = params["xps"]
+	f.Cost = params["cost"]
 	return &f
 }
 
 func init() {
 	game.RegisterAbility("fire", makeFire)
-	gob.Register(&fire{})
+	game.RegisterType(&fire{})
+	game.RegisterType(&asplosionProc{})
 }
 
 type fire struct {
-	id             int
-	region         fireRegion
-	cost           float64
-	distToCenter   float64
-	deviance       float64
-	startRadius    float64
-	endRadius      float64
-	durationThinks int
-	dps            float64
-	xps            float64
-	draw           bool
-	active         bool
-	trigger        bool
-	draining       bool
+	Id             int
+	Region         fireRegion
+	Cost           float64
+	DistToCenter   float64
+	Deviance       float64
+	StartRadius    float64
+	EndRadius      float64
+	DurationThinks int
+	Dps            float64
+	Xps            float64
+	Drawing        bool
+	Active         bool
+	Trigger        bool
+	Draining       bool
 
 	// Used to carry over a fraction of an explosion from one frame to the next
 	// so that we can accurately hit the xps (explisions per second).
-	xFrac float64
+	XFrac float64
 }
 
 func (f *fire) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
-	f.draw = pressAmt > 0
+	f.Drawing = pressAmt > 0
 	if !trigger || pressAmt == 0.0 {
-		f.trigger = false
-		f.draining = false
+		f.Trigger = false
+		f.Draining = false
 	}
-	if !f.trigger {
-		f.trigger = trigger
-		f.draining = true
+	if !f.Trigger {
+		f.Trigger = trigger
+		f.Draining = true
 		player := ent.(*game.PlayerEnt)
 		if pressAmt == 0 {
-			delete(player.Processes, f.id)
+			delete(player.Processes, f.Id)
 			return
 		}
-		_, ok := player.Processes[f.id].(*multiDrain)
+		_, ok := player.Processes[f.Id].(*multiDrain)
 		if !ok {
-			player.Processes[f.id] = &multiDrain{Gid: player.Gid, Unit: game.Mana{f.cost, 0, 0}}
+			player.Processes[f.Id] = &multiDrain{Gid: player.Gid, Unit: game.Mana{f.Cost, 0, 0}}
 			return
 		}
 	}
@@ -92,41 +92,41 @@ func (f *fire) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool)
 func (f *fire) getFrontPos(ent game.Ent, g *game.Game) linear.Vec2 {
 	r := rand.New(g.Rng)
 	theta := r.Float64() * math.Pi * 2
-	dist := math.Abs(r.NormFloat64() * f.deviance)
-	if dist > f.deviance*4 {
-		dist = f.deviance * 4
+	dist := math.Abs(r.NormFloat64() * f.Deviance)
+	if dist > f.Deviance*4 {
+		dist = f.Deviance * 4
 	}
 	dist = dist + dist*math.Cos(theta)
-	center := (linear.Vec2{f.distToCenter, 0}).Rotate(ent.Angle()).Add(ent.Pos())
+	center := (linear.Vec2{f.DistToCenter, 0}).Rotate(ent.Angle()).Add(ent.Pos())
 	return (linear.Vec2{0, dist}).Rotate(ent.Angle() - math.Pi/2 + theta).Add(center)
 }
 
 func (f *fire) getFlankPos(ent game.Ent, g *game.Game) linear.Vec2 {
 	r := rand.New(g.Rng)
 	theta := r.Float64() * math.Pi * 2
-	dist := math.Abs(r.NormFloat64() * f.deviance)
-	if dist > f.deviance*4 {
-		dist = f.deviance * 4
+	dist := math.Abs(r.NormFloat64() * f.Deviance)
+	if dist > f.Deviance*4 {
+		dist = f.Deviance * 4
 	}
 	dist = dist + dist*math.Cos(theta)
-	center := (linear.Vec2{f.distToCenter, 0}).Rotate(ent.Angle()).Add(ent.Pos())
+	center := (linear.Vec2{f.DistToCenter, 0}).Rotate(ent.Angle()).Add(ent.Pos())
 	return (linear.Vec2{0, dist}).Rotate(ent.Angle() - math.Pi/2 + theta).Add(center)
 }
 
 func (f *fire) getBackPos(ent game.Ent, g *game.Game) linear.Vec2 {
 	r := rand.New(g.Rng)
 	theta := r.Float64() * math.Pi * 2
-	dist := math.Abs(r.NormFloat64() * f.deviance)
-	if dist > f.deviance*4 {
-		dist = f.deviance * 4
+	dist := math.Abs(r.NormFloat64() * f.Deviance)
+	if dist > f.Deviance*4 {
+		dist = f.Deviance * 4
 	}
 	dist = dist + dist*math.Cos(theta)
-	center := (linear.Vec2{f.distToCenter, 0}).Rotate(ent.Angle() + math.Pi).Add(ent.Pos())
+	center := (linear.Vec2{f.DistToCenter, 0}).Rotate(ent.Angle() + math.Pi).Add(ent.Pos())
 	return (linear.Vec2{0, dist}).Rotate(ent.Angle() + math.Pi/2 + theta).Add(center)
 }
 
 func (f *fire) getPos(ent game.Ent, g *game.Game) linear.Vec2 {
-	switch f.region {
+	switch f.Region {
 	case fireRegionFront:
 		return f.getFrontPos(ent, g)
 	case fireRegionFlank:
@@ -140,27 +140,28 @@ func (f *fire) getPos(ent game.Ent, g *game.Game) linear.Vec2 {
 
 func (f *fire) Think(ent game.Ent, g *game.Game) {
 	player := ent.(*game.PlayerEnt)
-	proc, ok := player.Processes[f.id].(*multiDrain)
+	proc, ok := player.Processes[f.Id].(*multiDrain)
 	if !ok {
 		return
 	}
-	if f.trigger && f.draining && proc.Stored > 1 {
+	if f.Trigger && f.Draining && proc.Stored > 1 {
 		proc.Stored -= 0.1
 
 		// TODO: This is assuming 60fps - maybe that should be checked somewhere?
-		for f.xFrac += f.xps / 60.0; f.xFrac > 0.0; f.xFrac-- {
+		for f.XFrac += f.Xps / 60.0; f.XFrac > 0.0; f.XFrac-- {
 			g.Processes = append(g.Processes, &asplosionProc{
-				StartRadius:    f.startRadius,
-				EndRadius:      f.endRadius,
-				DurationThinks: f.durationThinks,
-				Dps:            f.dps,
+				StartRadius:    f.StartRadius,
+				EndRadius:      f.EndRadius,
+				DurationThinks: f.DurationThinks,
+				Dps:            f.Dps,
 				Pos:            f.getPos(ent, g),
+				Source:         ent.Id(),
 			})
 		}
 
 		if proc.Stored <= 1.0 {
-			f.draining = false
-			f.xFrac = 0
+			f.Draining = false
+			f.XFrac = 0
 		}
 	}
 }
@@ -181,6 +182,9 @@ type asplosionProc struct {
 	Dps            float64
 	Pos            linear.Vec2
 	Killed         bool
+
+	// Gid of the ent that started the fire.
+	Source game.Gid
 }
 
 func (p *asplosionProc) Supply(mana game.Mana) game.Mana {
@@ -191,7 +195,7 @@ func (p *asplosionProc) Think(g *game.Game) {
 	p.CurrentRadius = float64(p.NumThinks)/float64(p.DurationThinks)*(p.EndRadius-p.StartRadius) + p.StartRadius
 	for _, ent := range g.Ents {
 		if ent.Pos().Sub(p.Pos).Mag2() <= p.CurrentRadius*p.CurrentRadius {
-			ent.Stats().ApplyDamage(stats.Damage{stats.DamageFire, p.Dps})
+			ent.Stats().ApplyDamage(stats.Damage{Kind: stats.DamageFire, Amt: p.Dps, Source: string(p.Source), Ability: "fire"})
 		}
 	}
 }
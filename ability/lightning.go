@@ -1,58 +1,58 @@
 package ability
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/game"
 	"github.com/runningwild/jota/stats"
 	"github.com/runningwild/linear"
 	"math"
 )
 
-func makeLightning(params map[string]float64) game.Ability {
+func makeLightning(id int, params map[string]float64) game.Ability {
 	var l lightning
-	l.id = NextAbilityId()
-	l.cost = params["cost"]
-	l.width = params["width"]
-	l.buildThinks = int(params["buildThinks"])
-	l.durationThinks = int(params["durationThinks"])
-	l.dps = params["dps"]
+	l.Id = id
+	l.Cost = params["cost"]
+	l.Width = params["width"]
+	l.BuildThinks = int(params["buildThinks"])
+	l.DurationThinks = int(params["durationThinks"])
+	l.Dps = params["dps"]
 	return &l
 }
 
 func init() {
 	game.RegisterAbility("lightning", makeLightning)
-	gob.Register(&lightning{})
+	game.RegisterType(&lightning{})
+	game.RegisterType(&lightningBoltProc{})
 }
 
 type lightning struct {
-	id int
+	Id int
 
 	// Params
-	cost           float64
-	width          float64
-	buildThinks    int
-	durationThinks int
-	dps            float64
+	Cost           float64
+	Width          float64
+	BuildThinks    int
+	DurationThinks int
+	Dps            float64
 
-	draw    bool
-	trigger bool
+	Drawing bool
+	Trigger bool
 }
 
 func (l *lightning) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
-	l.draw = pressAmt > 0
+	l.Drawing = pressAmt > 0
 	if !trigger || pressAmt == 0.0 {
-		l.trigger = false
+		l.Trigger = false
 	}
-	if !l.trigger {
-		l.trigger = trigger
+	if !l.Trigger {
+		l.Trigger = trigger
 		player := ent.(*game.PlayerEnt)
 		if pressAmt == 0 {
-			delete(player.Processes, l.id)
+			delete(player.Processes, l.Id)
 			return
 		}
-		_, ok := player.Processes[l.id].(*multiDrain)
+		_, ok := player.Processes[l.Id].(*multiDrain)
 		if !ok {
-			player.Processes[l.id] = &multiDrain{Gid: player.Gid, Unit: game.Mana{0, l.cost, 0}}
+			player.Processes[l.Id] = &multiDrain{Gid: player.Gid, Unit: game.Mana{0, l.Cost, 0}}
 			return
 		}
 	}
@@ -60,12 +60,12 @@ func (l *lightning) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger
 
 func (l *lightning) Think(ent game.Ent, g *game.Game) {
 	player := ent.(*game.PlayerEnt)
-	proc, ok := player.Processes[l.id].(*multiDrain)
+	proc, ok := player.Processes[l.Id].(*multiDrain)
 	if !ok {
 		return
 	}
-	if l.trigger && proc.Stored > 1 {
-		delete(player.Processes, l.id)
+	if l.Trigger && proc.Stored > 1 {
+		delete(player.Processes, l.Id)
 		// find the endpoits of the lightning
 		forward := (linear.Vec2{1, 0}).Rotate(player.Angle()).Scale(10000)
 		bounds := [2]linear.Seg2{
@@ -98,12 +98,13 @@ func (l *lightning) Think(ent game.Ent, g *game.Game) {
 			}
 		}
 		g.Processes = append(g.Processes, &lightningBoltProc{
-			BuildThinks:    l.buildThinks,
-			DurationThinks: l.durationThinks,
-			Width:          l.width * math.Sqrt(proc.Stored),
-			Dps:            l.dps,
+			BuildThinks:    l.BuildThinks,
+			DurationThinks: l.DurationThinks,
+			Width:          l.Width * math.Sqrt(proc.Stored),
+			Dps:            l.Dps,
 			Power:          proc.Stored,
 			Seg:            linear.Seg2{isects[0], isects[1]},
+			Source:         player.Gid,
 		})
 	}
 }
@@ -121,6 +122,9 @@ type lightningBoltProc struct {
 	Power          float64
 	Seg            linear.Seg2
 	Killed         bool
+
+	// Gid of the player that cast the bolt.
+	Source game.Gid
 }
 
 func (p *lightningBoltProc) Supply(mana game.Mana) game.Mana {
@@ -138,7 +142,7 @@ func (p *lightningBoltProc) Think(g *game.Game) {
 			ent.Pos().Add(perp),
 		}
 		if entSeg.DoesIsect(p.Seg) {
-			ent.Stats().ApplyDamage(stats.Damage{stats.DamageFire, p.Dps * p.Power})
+			ent.Stats().ApplyDamage(stats.Damage{Kind: stats.DamageFire, Amt: p.Dps * p.Power, Source: string(p.Source), Ability: "lightning"})
 		}
 	}
 	// for _, ent := range g.Ents {
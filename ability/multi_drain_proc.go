@@ -22,6 +22,10 @@ type multiDrain struct {
 	Killed bool
 }
 
+func init() {
+	game.RegisterType(&multiDrain{})
+}
+
 func (p *multiDrain) Supply(mana game.Mana) game.Mana {
 	frac := -1.0
 	for color, amt := range p.Unit {
@@ -1,54 +1,54 @@
 package ability
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/game"
 	"github.com/runningwild/jota/stats"
 )
 
-func makeNitro(params map[string]float64) game.Ability {
+func makeNitro(id int, params map[string]float64) game.Ability {
 	var n nitro
-	n.id = NextAbilityId()
-	n.maxNitro = params["maxNitro"]
-	n.manaPerNitro = params["manaPerNitro"]
-	n.nitroPerTick = params["nitroPerTick"]
+	n.Id = id
+	n.MaxNitro = params["maxNitro"]
+	n.ManaPerNitro = params["manaPerNitro"]
+	n.NitroPerTick = params["nitroPerTick"]
 	return &n
 }
 
 func init() {
 	game.RegisterAbility("nitro", makeNitro)
-	gob.Register(&nitro{})
+	game.RegisterType(&nitro{})
+	game.RegisterType(&nitroProc{})
 }
 
 type nitro struct {
-	id int
+	Id int
 
 	// Params
-	maxNitro     float64
-	manaPerNitro float64
-	nitroPerTick float64
+	MaxNitro     float64
+	ManaPerNitro float64
+	NitroPerTick float64
 
-	on       bool
-	previous struct {
-		pressAmt float64
-		trigger  bool
+	On       bool
+	Previous struct {
+		PressAmt float64
+		Trigger  bool
 	}
 }
 
 func (n *nitro) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
 	player := ent.(*game.PlayerEnt)
-	if pressAmt == n.previous.pressAmt {
+	if pressAmt == n.Previous.PressAmt {
 		return
 	}
-	if !n.on {
-		n.on = pressAmt > 0
+	if !n.On {
+		n.On = pressAmt > 0
 	} else {
-		n.on = pressAmt == 0
+		n.On = pressAmt == 0
 	}
-	if n.on {
-		player.Processes[n.id] = &nitroProc{Gid: player.Gid, MaxNitro: n.maxNitro, ManaPerNitro: n.manaPerNitro, NitroPerTick: n.nitroPerTick}
+	if n.On {
+		player.Processes[n.Id] = &nitroProc{Gid: player.Gid, MaxNitro: n.MaxNitro, ManaPerNitro: n.ManaPerNitro, NitroPerTick: n.NitroPerTick}
 	} else {
-		delete(player.Processes, n.id)
+		delete(player.Processes, n.Id)
 		return
 	}
 }
@@ -1,53 +1,52 @@
 package ability
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/game"
 	"github.com/runningwild/linear"
 )
 
-func makePlaceMine(params map[string]float64) game.Ability {
+func makePlaceMine(id int, params map[string]float64) game.Ability {
 	var pm placeMine
-	pm.id = NextAbilityId()
-	pm.health = params["health"]
-	pm.damage = params["damage"]
-	pm.trigger = params["trigger"]
-	pm.mass = params["mass"]
-	pm.cost = params["cost"]
+	pm.Id = id
+	pm.Health = params["health"]
+	pm.Damage = params["damage"]
+	pm.Trigger = params["trigger"]
+	pm.Mass = params["mass"]
+	pm.Cost = params["cost"]
 	return &pm
 }
 
 func init() {
 	game.RegisterAbility("mine", makePlaceMine)
-	gob.Register(&placeMine{})
+	game.RegisterType(&placeMine{})
 }
 
 type placeMine struct {
-	id      int
-	health  float64
-	damage  float64
-	trigger float64
-	mass    float64
-	cost    float64
-	fire    int
+	Id      int
+	Health  float64
+	Damage  float64
+	Trigger float64
+	Mass    float64
+	Cost    float64
+	Fire    int
 }
 
 func (pm *placeMine) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
 	player := ent.(*game.PlayerEnt)
 	if pressAmt == 0 {
-		delete(player.Processes, pm.id)
+		delete(player.Processes, pm.Id)
 		return
 	}
-	proc, ok := player.Processes[pm.id].(*multiDrain)
+	proc, ok := player.Processes[pm.Id].(*multiDrain)
 	if !ok {
-		player.Processes[pm.id] = &multiDrain{Gid: player.Gid, Unit: game.Mana{300, 0, 0}}
+		player.Processes[pm.Id] = &multiDrain{Gid: player.Gid, Unit: game.Mana{300, 0, 0}}
 		return
 	}
 	if trigger && proc.Stored > 1 {
 		proc.Stored--
 		heading := (linear.Vec2{1, 0}).Rotate(ent.Angle())
 		pos := ent.Pos().Add(heading.Scale(100))
-		g.MakeMine(pos, linear.Vec2{}, 100, 100, 100, 100)
+		g.MakeMine(player.Gid, pos, linear.Vec2{}, 100, 100, 100, 100)
 	}
 }
 func (pm *placeMine) Think(ent game.Ent, game *game.Game) {
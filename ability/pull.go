@@ -1,69 +1,70 @@
 package ability
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/game"
 	"math"
 )
 
-func makePull(params map[string]float64) game.Ability {
+func makePull(id int, params map[string]float64) game.Ability {
 	var p pull
-	p.id = NextAbilityId()
-	p.force = params["force"]
-	p.angle = params["angle"] * math.Pi / 180
-	p.cost = params["cost"]
+	p.Id = id
+	p.Force = params["force"]
+	p.Angle = params["angle"] * math.Pi / 180
+	p.Cost = params["cost"]
 	return &p
 }
 
 func init() {
 	game.RegisterAbility("pull", makePull)
-	gob.Register(&pull{})
+	game.RegisterType(&pull{})
 }
 
 type pull struct {
-	id       int
-	force    float64
-	angle    float64
-	cost     float64
-	draw     bool
-	active   bool
-	trigger  bool
-	draining bool
+	Id       int
+	Force    float64
+	Angle    float64
+	Cost     float64
+	Drawing  bool
+	Active   bool
+	Trigger  bool
+	Draining bool
 }
 
 func (p *pull) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
-	p.draw = pressAmt > 0
+	p.Drawing = pressAmt > 0
 	if !trigger || pressAmt == 0.0 {
-		p.trigger = false
-		p.draining = false
+		p.Trigger = false
+		p.Draining = false
 	}
-	if !p.trigger {
-		p.trigger = trigger
-		p.draining = true
+	if !p.Trigger {
+		p.Trigger = trigger
+		p.Draining = true
 		player := ent.(*game.PlayerEnt)
 		if pressAmt == 0 {
-			delete(player.Processes, p.id)
+			delete(player.Processes, p.Id)
 			return
 		}
-		_, ok := player.Processes[p.id].(*multiDrain)
+		_, ok := player.Processes[p.Id].(*multiDrain)
 		if !ok {
-			player.Processes[p.id] = &multiDrain{Gid: player.Gid, Unit: game.Mana{0, 0, p.cost}}
+			player.Processes[p.Id] = &multiDrain{Gid: player.Gid, Unit: game.Mana{0, 0, p.Cost}}
 			return
 		}
 	}
 }
 func (p *pull) Think(ent game.Ent, g *game.Game) {
 	player := ent.(*game.PlayerEnt)
-	proc, ok := player.Processes[p.id].(*multiDrain)
+	proc, ok := player.Processes[p.Id].(*multiDrain)
 	if !ok {
 		return
 	}
-	if p.trigger && p.draining && proc.Stored > 1 {
+	if p.Trigger && p.Draining && proc.Stored > 1 {
 		proc.Stored -= 0.1
 		if proc.Stored <= 1.0 {
-			p.draining = false
+			p.Draining = false
 		}
-		for _, ent := range g.Ents {
+		// The force on the player accumulates over every ent, so this needs to be
+		// done in the same order on every engine.
+		for _, ent := range g.AllEnts() {
 			ray := ent.Pos().Sub(player.Pos())
 			if ray.Mag2() < 0.1 {
 				continue
@@ -75,13 +76,13 @@ func (p *pull) Think(ent game.Ent, g *game.Game) {
 			for target_angle > math.Pi*2 {
 				target_angle -= math.Pi * 2
 			}
-			if target_angle > p.angle/2 && target_angle < math.Pi*2-p.angle/2 {
+			if target_angle > p.Angle/2 && target_angle < math.Pi*2-p.Angle/2 {
 				continue
 			}
 			ray = player.Pos().Sub(ent.Pos())
 			ray = ray.Norm()
-			ent.ApplyForce(ray.Scale(-p.force))
-			player.ApplyForce(ray.Scale(p.force).Scale(0.01))
+			ent.ApplyForce(ray.Scale(-p.Force))
+			player.ApplyForce(ray.Scale(p.Force).Scale(0.01))
 		}
 	}
 }
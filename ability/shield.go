@@ -1,52 +1,52 @@
 package ability
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/game"
 	"github.com/runningwild/jota/stats"
 )
 
-func makeShield(params map[string]float64) game.Ability {
+func makeShield(id int, params map[string]float64) game.Ability {
 	var s shield
-	s.id = NextAbilityId()
-	s.maxShield = params["maxShield"]
-	s.manaPerShield = params["manaPerShield"]
+	s.Id = id
+	s.MaxShield = params["maxShield"]
+	s.ManaPerShield = params["manaPerShield"]
 	return &s
 }
 
 func init() {
 	game.RegisterAbility("shield", makeShield)
-	gob.Register(&shield{})
+	game.RegisterType(&shield{})
+	game.RegisterType(&shieldProc{})
 }
 
 type shield struct {
-	id int
+	Id int
 
 	// Params
-	maxShield     float64
-	manaPerShield float64
+	MaxShield     float64
+	ManaPerShield float64
 
-	on       bool
-	previous struct {
-		pressAmt float64
-		trigger  bool
+	On       bool
+	Previous struct {
+		PressAmt float64
+		Trigger  bool
 	}
 }
 
 func (s *shield) Input(ent game.Ent, g *game.Game, pressAmt float64, trigger bool) {
 	player := ent.(*game.PlayerEnt)
-	if pressAmt == s.previous.pressAmt {
+	if pressAmt == s.Previous.PressAmt {
 		return
 	}
-	if !s.on {
-		s.on = pressAmt > 0
+	if !s.On {
+		s.On = pressAmt > 0
 	} else {
-		s.on = pressAmt == 0
+		s.On = pressAmt == 0
 	}
-	if s.on {
-		player.Processes[s.id] = &shieldProc{Gid: player.Gid, MaxShield: s.maxShield, ManaPerShield: s.manaPerShield}
+	if s.On {
+		player.Processes[s.Id] = &shieldProc{Gid: player.Gid, MaxShield: s.MaxShield, ManaPerShield: s.ManaPerShield}
 	} else {
-		delete(player.Processes, s.id)
+		delete(player.Processes, s.Id)
 		return
 	}
 }
@@ -1,5 +1,9 @@
 package champ
 
+import (
+	"github.com/runningwild/jota/stats"
+)
+
 type Ability struct {
 	Name   string
 	Params map[string]float64
@@ -13,4 +17,8 @@ type Champion struct {
 type ChampionDef struct {
 	Name      string
 	Abilities []Ability
+
+	// Added to the armor and resistance of whatever ship the champion flies.
+	Armor      stats.PerKind
+	Resistance stats.PerKind
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/runningwild/jota/base"
+	"github.com/runningwild/jota/lan"
+	"github.com/runningwild/jota/netsim"
+	"strconv"
+)
+
+const (
+	defaultAddr = "thunderingvictory.dyndns.org"
+	defaultPort = 20007
+	defaultName = "thunderball"
+)
+
+var (
+	addrFlag = flag.String("addr", defaultAddr, "Address of the host to connect to.")
+	portFlag = flag.Int("port", defaultPort, "Port to connect to, or to host on.")
+	nameFlag = flag.String("name", defaultName, "Name of the hosted game.")
+
+	lanTargetFlag = flag.String("lan-target", lan.DefaultTarget, "Address a host announces its game to, empty disables announcing.")
+	lanPortFlag   = flag.Int("lan-port", lan.Port, "Port to listen for games announced on the LAN.")
+
+	simLatencyFlag = flag.Duration("sim-latency", 0, "Latency to add to each direction of a client's connection, like 75ms.")
+	simJitterFlag  = flag.Duration("sim-jitter", 0, "Most random delay to add to each packet on top of -sim-latency.")
+	simLossFlag    = flag.Float64("sim-loss", 0, "Fraction of packets to lose, from 0 to 1.")
+	simReorderFlag = flag.Float64("sim-reorder", 0, "Fraction of udp packets to deliver out of order, from 0 to 1.")
+	simSeedFlag    = flag.Int64("sim-seed", 0, "Seed for the network simulator.")
+)
+
+// Network simulator the client is connected through, if any of the sim flags
+// were set.
+var simProxy *netsim.Proxy
+
+// Announces the game on the LAN while hosting, if -lan-target is set.
+var lanAnnouncer *lan.Announcer
+
+// connection is where a client connects to, or what a host hosts as.
+type connection struct {
+	Addr string
+	Port int
+	Name string
+}
+
+// Keys used for the connection settings in the store.
+const (
+	storeAddr = "host address"
+	storePort = "host port"
+	storeName = "game name"
+)
+
+// loadConnection builds the connection from the defaults, then the store, then
+// any flags that were explicitly set.  explicit is true if the address was set
+// on the command line.
+func loadConnection() (conn connection, explicit bool) {
+	conn = connection{Addr: defaultAddr, Port: defaultPort, Name: defaultName}
+	if addr := base.GetStoreVal(storeAddr); addr != "" {
+		conn.Addr = addr
+	}
+	if port := base.GetStoreVal(storePort); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 {
+			base.Warn().Printf("Ignoring invalid port in store: %q", port)
+		} else {
+			conn.Port = p
+		}
+	}
+	if name := base.GetStoreVal(storeName); name != "" {
+		conn.Name = name
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			conn.Addr = *addrFlag
+			explicit = true
+		case "port":
+			conn.Port = *portFlag
+		case "name":
+			conn.Name = *nameFlag
+		}
+	})
+	return
+}
+
+// save writes the connection to the store so that it is used next time.
+func (conn connection) save() {
+	base.SetStoreVal(storeAddr, conn.Addr)
+	base.SetStoreVal(storePort, fmt.Sprintf("%d", conn.Port))
+	base.SetStoreVal(storeName, conn.Name)
+}
+
+// simulateNetwork starts a network simulator between a client and conn if any
+// of the sim flags were set, and returns the connection the client should use
+// instead.
+func simulateNetwork(conn connection) connection {
+	config := netsim.Config{
+		Latency: *simLatencyFlag,
+		Jitter:  *simJitterFlag,
+		Loss:    *simLossFlag,
+		Reorder: *simReorderFlag,
+		Seed:    *simSeedFlag,
+	}
+	if !config.Enabled() {
+		return conn
+	}
+	proxy, err := netsim.Listen(config, 0, fmt.Sprintf("%s:%d", conn.Addr, conn.Port))
+	if err != nil {
+		base.Error().Printf("Unable to start the network simulator: %v", err)
+		return conn
+	}
+	simProxy = proxy
+	conn.Addr = "127.0.0.1"
+	conn.Port = proxy.Port()
+	return conn
+}
@@ -14,6 +14,7 @@ func makeSilence(params map[string]float64) game.Process {
 
 func init() {
 	game.RegisterEffect("silence", makeSilence)
+	game.RegisterType(&silence{})
 }
 
 type silence struct {
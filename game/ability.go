@@ -18,7 +18,11 @@ type Ability interface {
 	IsActive() bool
 }
 
-type AbilityMaker func(params map[string]float64) Ability
+// An AbilityMaker makes an ability from its params.  id is unique within the
+// game and should be used as the key of any Process the ability adds to an
+// ent, since ids are part of the game state they are the same on every engine,
+// including ones that joined after the ability was made.
+type AbilityMaker func(id int, params map[string]float64) Ability
 
 var ability_makers map[string]AbilityMaker
 
@@ -29,6 +33,10 @@ func RegisterAbility(name string, maker AbilityMaker) {
 	ability_makers[name] = maker
 }
 
+func (g *Game) makeAbility(name string, params map[string]float64) Ability {
+	return ability_makers[name](g.NextId(), params)
+}
+
 type UseAbility struct {
 	Gid     Gid
 	Index   int
@@ -42,6 +50,7 @@ func init() {
 
 func (m UseAbility) Apply(_g interface{}) {
 	g := _g.(*Game)
+	g.recordEvent(m)
 	ent, ok := g.Ents[m.Gid]
 	if !ok || ent == nil {
 		base.Error().Printf("Got a use ability that made no sense: %v", m)
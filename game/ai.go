@@ -0,0 +1,155 @@
+package game
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/runningwild/jota/base"
+)
+
+// Normally every Ai's script runs in its own goroutine on the host and sends
+// events whenever it gets around to it, so what the Ais do depends on how busy
+// the host is.  When DeterministicAi is set the Ais are ticked instead.  The
+// host still runs them, since it's the only engine that is there for the whole
+// game, but it runs each one inside Think, in the order of their ents, until
+// it sleeps or uses up its calls for the frame, and all it can see is the
+// snapshot of that frame.  Everything the Ais send during a frame is sent
+// together as one AiEvents, which every engine applies aiEventDelay frames
+// later.  As long as the AiEvents arrive in time the same match with the same
+// seed always gets the same events on the same frames.
+
+// Frames between a ticked Ai sending events and them being applied.  This has
+// to be longer than it takes an event sent by the host to reach every engine,
+// otherwise they are applied late.
+const aiEventDelay = 10
+
+// A TickedAi is an Ai that can be run inside Think, see DeterministicAi.
+type TickedAi interface {
+	Ai
+
+	// Tick runs the Ai for the frame that s is a snapshot of, and returns the
+	// events it sent in the order that it sent them.
+	Tick(s *Snapshot) []Event
+}
+
+// AiEvents are the events sent by ticked Ais during a frame.
+type AiEvents struct {
+	// Frame the events should be applied on.
+	Frame  int
+	Events []Event
+}
+
+func init() {
+	gob.Register(AiEvents{})
+}
+
+// AiEvents are not recorded themselves, instead each of the events in them is
+// recorded when it is applied.  That way a replay applies them on the same
+// frame without having to wait aiEventDelay frames.
+func (a AiEvents) Apply(_g interface{}) {
+	g := _g.(*Game)
+	if a.Frame < g.Frame {
+		base.Warn().Printf("Ai events for frame %d arrived on frame %d, applying them late", a.Frame, g.Frame)
+	}
+	g.PendingAiEvents = append(g.PendingAiEvents, a)
+}
+
+// runsAis returns true if this engine runs the game's Ais, which is only ever
+// the host.
+func (g *Game) runsAis() bool {
+	return g.local.Engine != nil && g.local.Engine.IsHost()
+}
+
+// applyAiEvents applies every event sent by ticked Ais that is due.  This is
+// done at the start of the frame so that it happens at the same point in the
+// frame as any other event would.
+func (g *Game) applyAiEvents() {
+	i := 0
+	for ; i < len(g.PendingAiEvents) && g.PendingAiEvents[i].Frame <= g.Frame; i++ {
+		for _, event := range g.PendingAiEvents[i].Events {
+			event.Apply(g)
+		}
+	}
+	g.PendingAiEvents = g.PendingAiEvents[i:]
+}
+
+// thinkAis ticks every ticked Ai on this engine and sends what they did.
+func (g *Game) thinkAis() {
+	if !g.DeterministicAi || !g.runsAis() {
+		return
+	}
+	s := g.Snapshot()
+	if s == nil {
+		return
+	}
+	var events []Event
+	for _, ent := range g.local.temp.AllEnts {
+		b, ok := baseEntOf(ent)
+		if !ok || b.ai == nil {
+			continue
+		}
+		if ai, ok := b.ai.(TickedAi); ok {
+			events = append(events, ai.Tick(s)...)
+		}
+	}
+	if len(events) > 0 {
+		g.local.Engine.ApplyEvent(AiEvents{Frame: g.Frame + aiEventDelay, Events: events})
+	}
+}
+
+// AiState describes whether an Ai's script is running.
+type AiState int
+
+const (
+	AiRunning AiState = iota
+
+	// The script failed and is waiting to be restarted.
+	AiErrored
+
+	// The script returned, so there's nothing left for it to do.
+	AiFinished
+
+	// The Ai was terminated, usually because its ent died.
+	AiTerminated
+)
+
+func (s AiState) String() string {
+	switch s {
+	case AiRunning:
+		return "running"
+	case AiErrored:
+		return "errored"
+	case AiFinished:
+		return "finished"
+	case AiTerminated:
+		return "terminated"
+	}
+	return fmt.Sprintf("AiState(%d)", int(s))
+}
+
+type AiStatus struct {
+	State AiState
+
+	// The most recent error, with the script's file and line if they are known,
+	// and the number of times the script has failed.
+	Err      string
+	Failures int
+}
+
+func (s AiStatus) String() string {
+	if s.Failures == 0 {
+		return s.State.String()
+	}
+	return fmt.Sprintf("%v, failed %d time(s), last error: %s", s.State, s.Failures, s.Err)
+}
+
+// AiStatuses returns the status of every Ai running on this engine, by the Gid
+// of the ent it controls.
+func (g *Game) AiStatuses() map[Gid]AiStatus {
+	statuses := make(map[Gid]AiStatus)
+	g.DoForEnts(func(gid Gid, ent Ent) {
+		if b, ok := baseEntOf(ent); ok && b.ai != nil {
+			statuses[gid] = b.ai.Status()
+		}
+	})
+	return statuses
+}
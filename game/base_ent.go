@@ -1,7 +1,6 @@
 package game
 
 import (
-	"github.com/runningwild/cgf"
 	"github.com/runningwild/jota/base"
 	"github.com/runningwild/jota/stats"
 	"github.com/runningwild/linear"
@@ -28,7 +27,25 @@ type BaseEnt struct {
 	// Processes contains all of the processes that this player is casting
 	// right now.
 	Processes map[int]Process
-	ai        Ai
+
+	// Pids of the processes that were applied to StatsInst as conditions during
+	// the last Think, in the order they were applied.  See relinkConditions.
+	ConditionPids []int
+
+	ai Ai
+}
+
+// EntProcesses returns the processes on ent, ordered by their ids.
+func EntProcesses(ent Ent) []Process {
+	b, ok := baseEntOf(ent)
+	if !ok {
+		return nil
+	}
+	var procs []Process
+	base.DoOrdered(b.Processes, func(a, b int) bool { return a < b }, func(_ int, proc Process) {
+		procs = append(procs, proc)
+	})
+	return procs
 }
 
 func (b *BaseEnt) Side() int {
@@ -67,8 +84,8 @@ func (b *BaseEnt) Pos() linear.Vec2 {
 func (b *BaseEnt) Vel() linear.Vec2 {
 	return b.Velocity
 }
-func (b *BaseEnt) Move(angle, magnitude float64) {
-	if magnitude == 0 {
+func (b *BaseEnt) Move(angle, magnitude float64, face bool) {
+	if magnitude == 0 && !face {
 		b.Target.Angle = b.Angle_
 	} else {
 		b.Target.Angle = angle
@@ -97,7 +114,13 @@ func (b *BaseEnt) Abilities() []Ability {
 	return b.Abilities_
 }
 
-func (b *BaseEnt) BindAi(name string, engine *cgf.Engine) {
+func (b *BaseEnt) BindAi(name string, g *Game) {
+	b.bindAiWithParams(name, g, nil)
+}
+
+// bindAiWithParams is like BindAi, but the params are set before the Ai starts
+// so that they are available as soon as its script runs.
+func (b *BaseEnt) bindAiWithParams(name string, g *Game, params map[string]interface{}) {
 	if b.ai != nil {
 		base.Warn().Printf("Can't bind an Ai when there is already one bound.")
 		return
@@ -106,14 +129,47 @@ func (b *BaseEnt) BindAi(name string, engine *cgf.Engine) {
 		base.Error().Printf("Can't bind an Ai on an ent before setting its Gid.")
 		return
 	}
-	b.ai = ai_maker(name, engine, b.Gid)
+	if g.local.Engine == nil {
+		// There's no engine when playing back a replay, in which case all of the
+		// Ai's actions are already recorded.
+		return
+	}
+	if !g.runsAis() {
+		// Only one engine runs the Ais, every other engine just sees the events
+		// they send.
+		return
+	}
+	b.ai = ai_maker(name, g.local.Engine, b.Gid, g.DeterministicAi)
+	for param, value := range params {
+		b.ai.SetParam(param, value)
+	}
 	b.ai.Start()
 }
 
+// relinkConditions points the conditions in StatsInst back at the processes in
+// Processes that they came from.  After decoding they are separate copies, so
+// any changes a condition makes to itself, like a shield absorbing damage,
+// would otherwise not show up in the process.  Conditions whose process has
+// since been removed keep their decoded copy.
+func (b *BaseEnt) relinkConditions() {
+	conditions := b.StatsInst.Conditions()
+	for i, pid := range b.ConditionPids {
+		if i >= len(conditions) {
+			break
+		}
+		if proc, ok := b.Processes[pid]; ok {
+			conditions[i] = proc
+		}
+	}
+	b.StatsInst.SetConditions(conditions)
+}
+
 func (b *BaseEnt) Think(g *Game) {
 	// This will clear out old conditions
 	b.StatsInst.Think()
 
+	b.ConditionPids = b.ConditionPids[0:0]
+
 	var dead []int
 	// Calling DoOrdered is too slow, so we just sort the Gids ourselves and go
 	// through them in order.
@@ -129,6 +185,7 @@ func (b *BaseEnt) Think(g *Game) {
 			dead = append(dead, pid)
 		} else {
 			b.StatsInst.ApplyCondition(proc)
+			b.ConditionPids = append(b.ConditionPids, pid)
 		}
 	}
 
@@ -137,6 +194,14 @@ func (b *BaseEnt) Think(g *Game) {
 		delete(b.Processes, id)
 	}
 
+	b.thinkMovement(g)
+}
+
+// thinkMovement moves the ent for one frame according to its velocity and the
+// last Move applied to it, stopping it at any walls.  This doesn't change
+// anything but the ent's position, velocity and angle, so it is also used to
+// predict where local players are going, see predictionData.
+func (b *BaseEnt) thinkMovement(g *Game) {
 	if b.Delta.Speed < -1.0 {
 		b.Delta.Speed = -1.0
 	}
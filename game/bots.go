@@ -0,0 +1,177 @@
+package game
+
+import (
+	"encoding/gob"
+	"github.com/runningwild/jota/base"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Bots are players controlled by an agora script from data/scripts/bots.  They
+// use negative ids in SetupData.Players and Game.Engines, and are always ready.
+// Scripts only run on the host, every engine just sees the events they send.
+
+// Difficulty a bot is given when it's added from the lobby.
+const defaultBotDifficulty = 0.5
+
+// Step by which the lobby changes a bot's difficulty, wrapping around once it
+// goes past 1.
+const botDifficultyStep = 0.25
+
+type SetupAddBot struct {
+	Side  int
+	Champ int
+
+	// Name of the script, from Game.BotScripts, that controls the bot.
+	Script string
+
+	// From 0 to 1, passed to the script as the "difficulty" param.
+	Difficulty float64
+}
+
+type SetupRemoveBot struct {
+	Id int64
+}
+
+// SetupBotScript moves the bot's script forward or backward through
+// Game.BotScripts by Script, wrapping around at either end.
+type SetupBotScript struct {
+	Id     int64
+	Script int
+}
+
+type SetupBotDifficulty struct {
+	Id         int64
+	Difficulty float64
+}
+
+func init() {
+	gob.Register(SetupAddBot{})
+	gob.Register(SetupRemoveBot{})
+	gob.Register(SetupBotScript{})
+	gob.Register(SetupBotDifficulty{})
+}
+
+func (s SetupAddBot) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || len(g.BotScripts) == 0 {
+		return
+	}
+	if s.Champ < 0 || s.Champ >= len(g.Champs) {
+		return
+	}
+	script := s.Script
+	if g.botScriptIndex(script) == -1 {
+		script = g.BotScripts[0]
+	}
+	if g.Setup.Players == nil {
+		g.Setup.Players = make(map[int64]*SetupPlayerData)
+	}
+	g.Setup.Bots++
+	g.Setup.Players[-g.Setup.Bots] = &SetupPlayerData{
+		Side:       s.Side,
+		ChampIndex: s.Champ,
+		Ready:      true,
+		Script:     script,
+		Difficulty: clampDifficulty(s.Difficulty),
+	}
+}
+
+func (s SetupRemoveBot) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || s.Id >= 0 {
+		return
+	}
+	delete(g.Setup.Players, s.Id)
+}
+
+func (s SetupBotScript) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || s.Id >= 0 || len(g.BotScripts) == 0 {
+		return
+	}
+	player := g.Setup.Players[s.Id]
+	if player == nil {
+		return
+	}
+	index := g.botScriptIndex(player.Script)
+	if index == -1 {
+		index = 0
+	}
+	index = (index + s.Script) % len(g.BotScripts)
+	if index < 0 {
+		index += len(g.BotScripts)
+	}
+	player.Script = g.BotScripts[index]
+}
+
+func (s SetupBotDifficulty) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || s.Id >= 0 {
+		return
+	}
+	player := g.Setup.Players[s.Id]
+	if player == nil {
+		return
+	}
+	player.Difficulty = clampDifficulty(s.Difficulty)
+}
+
+func clampDifficulty(difficulty float64) float64 {
+	if difficulty < 0 {
+		return 0
+	}
+	if difficulty > 1 {
+		return 1
+	}
+	return difficulty
+}
+
+// BotIds returns the ids of every bot, in the order they were added.
+func (s *SetupData) BotIds() []int64 {
+	var ids []int64
+	for id := range s.Players {
+		if id < 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(int64Slice(ids)))
+	return ids
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (g *Game) botScriptIndex(script string) int {
+	for i := range g.BotScripts {
+		if g.BotScripts[i] == script {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadBotScripts returns the names of the scripts in data/scripts/bots,
+// relative to data/scripts and without the .agora extension, sorted by name.
+func loadBotScripts() []string {
+	dir := filepath.Join(base.GetDataDir(), "scripts", "bots")
+	paths, err := filepath.Glob(filepath.Join(dir, "*.agora"))
+	if err != nil {
+		base.Error().Printf("Unable to list bot scripts in '%s': %v", dir, err)
+		return nil
+	}
+	var scripts []string
+	for _, path := range paths {
+		scripts = append(scripts, "bots/"+strings.TrimSuffix(filepath.Base(path), ".agora"))
+	}
+	sort.Strings(scripts)
+	return scripts
+}
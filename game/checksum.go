@@ -0,0 +1,262 @@
+package game
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"github.com/runningwild/jota/base"
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Every ChecksumInterval frames each engine hashes its simulation state and
+// sends the result to every other engine.  Since all engines should be running
+// exactly the same simulation any difference means that they have desynced.
+
+// How many checksums to keep around to compare against checksums from other
+// engines.
+const checksumHistory = 10
+
+// A ChecksumSection is the hash of one part of the game state, like the
+// position of a single ent.
+type ChecksumSection struct {
+	Name string
+	Hash uint64
+}
+
+type StateChecksum struct {
+	EngineId int64
+	Frame    int
+	Total    uint64
+
+	// Sections are always in the same order for the same game state, so the
+	// first section that differs between two checksums is the first part of the
+	// state that diverged.
+	Sections []ChecksumSection
+}
+
+func init() {
+	gob.Register(StateChecksum{})
+}
+
+func (c StateChecksum) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(c)
+	if g.local.Engine != nil && c.EngineId == g.local.Engine.Id() {
+		return
+	}
+	g.local.Lock()
+	defer g.local.Unlock()
+	mine, ok := g.local.checksums[c.Frame]
+	if !ok {
+		return
+	}
+	if diff := mine.FirstDifference(&c); diff != "" {
+		base.Error().Printf("Desync with engine %d on frame %d, first difference: %s", c.EngineId, c.Frame, diff)
+		g.local.desyncs = append(g.local.desyncs, fmt.Sprintf("engine %d, frame %d: %s", c.EngineId, c.Frame, diff))
+	}
+}
+
+// FirstDifference returns the name of the first section that differs between
+// the two checksums, or the empty string if they are the same.
+func (c *StateChecksum) FirstDifference(other *StateChecksum) string {
+	if c.Total == other.Total {
+		return ""
+	}
+	theirs := make(map[string]uint64)
+	for _, section := range other.Sections {
+		theirs[section.Name] = section.Hash
+	}
+	for _, section := range c.Sections {
+		hash, ok := theirs[section.Name]
+		if !ok {
+			return fmt.Sprintf("%s (only exists locally)", section.Name)
+		}
+		if hash != section.Hash {
+			return section.Name
+		}
+		delete(theirs, section.Name)
+	}
+	for _, section := range other.Sections {
+		if _, ok := theirs[section.Name]; ok {
+			return fmt.Sprintf("%s (only exists remotely)", section.Name)
+		}
+	}
+	return "unknown"
+}
+
+// Desyncs returns a description of every desync that has been detected so far.
+func (g *Game) Desyncs() []string {
+	g.local.RLock()
+	defer g.local.RUnlock()
+	return append([]string(nil), g.local.desyncs...)
+}
+
+// Checksum computes the canonical hash of the current simulation state.
+func (g *Game) Checksum() *StateChecksum {
+	var c StateChecksum
+	c.Frame = g.Frame
+	if g.local.Engine != nil {
+		c.EngineId = g.local.Engine.Id()
+	}
+	h := fnv.New64a()
+	add := func(name string, hashFunc func(h hash.Hash64)) {
+		h.Reset()
+		hashFunc(h)
+		c.Sections = append(c.Sections, ChecksumSection{name, h.Sum64()})
+	}
+	add("Rng", func(h hash.Hash64) { hashValue(h, reflect.ValueOf(g.Rng), 0) })
+	add("ManaSource", func(h hash.Hash64) {
+		ms := &g.Level.ManaSource
+		hashValue(h, reflect.ValueOf(ms.thinks), 0)
+		for i := range ms.rawNodes {
+			for _, mana := range ms.rawNodes[i].Mana {
+				hashFloat(h, mana)
+			}
+		}
+	})
+	add("Processes", func(h hash.Hash64) { hashValue(h, reflect.ValueOf(g.Processes), 0) })
+	add("Mode", func(h hash.Hash64) { hashValue(h, reflect.ValueOf(g.Mode), 0) })
+	g.DoForEnts(func(gid Gid, ent Ent) {
+		prefix := fmt.Sprintf("Ent %s ", gid)
+		add(prefix+"Pos", func(h hash.Hash64) {
+			hashFloat(h, ent.Pos().X)
+			hashFloat(h, ent.Pos().Y)
+		})
+		add(prefix+"Vel", func(h hash.Hash64) {
+			hashFloat(h, ent.Vel().X)
+			hashFloat(h, ent.Vel().Y)
+		})
+		add(prefix+"Angle", func(h hash.Hash64) { hashFloat(h, ent.Angle()) })
+		add(prefix+"Health", func(h hash.Hash64) { hashFloat(h, ent.Stats().HealthCur()) })
+		add(prefix+"Side", func(h hash.Hash64) { hashValue(h, reflect.ValueOf(ent.Side()), 0) })
+		add(prefix+"Abilities", func(h hash.Hash64) { hashValue(h, reflect.ValueOf(ent.Abilities()), 0) })
+		if b, ok := baseEntOf(ent); ok {
+			add(prefix+"Processes", func(h hash.Hash64) { hashValue(h, reflect.ValueOf(b.Processes), 0) })
+		}
+	})
+
+	h.Reset()
+	for _, section := range c.Sections {
+		hashUint64(h, section.Hash)
+	}
+	c.Total = h.Sum64()
+	return &c
+}
+
+// baseEntOf returns the BaseEnt embedded in ent, if there is one.
+func baseEntOf(ent Ent) (*BaseEnt, bool) {
+	v := reflect.ValueOf(ent)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	field := v.Elem().FieldByName("BaseEnt")
+	if !field.IsValid() || !field.CanAddr() {
+		return nil, false
+	}
+	b, ok := field.Addr().Interface().(*BaseEnt)
+	return b, ok
+}
+
+// thinkChecksum computes and sends the checksum for this frame, if this is a
+// frame that needs one.
+func (g *Game) thinkChecksum() {
+	if g.ChecksumInterval <= 0 || g.Frame%g.ChecksumInterval != 0 {
+		return
+	}
+	c := g.Checksum()
+	g.local.Lock()
+	if g.local.checksums == nil {
+		g.local.checksums = make(map[int]*StateChecksum)
+	}
+	g.local.checksums[c.Frame] = c
+	delete(g.local.checksums, c.Frame-checksumHistory*g.ChecksumInterval)
+	g.local.Unlock()
+	if g.local.Engine != nil {
+		g.local.Engine.ApplyEvent(*c)
+	}
+}
+
+func hashUint64(h hash.Hash64, v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	h.Write(buf[:])
+}
+
+func hashFloat(h hash.Hash64, f float64) {
+	hashUint64(h, math.Float64bits(f))
+}
+
+// Deep enough for any reasonable Process, shallow enough to stop any cycles.
+const maxHashDepth = 10
+
+// hashValue hashes v, including unexported fields, in a way that only depends
+// on its contents.  Maps are hashed in sorted key order and pointers are
+// followed rather than hashed, so the result is the same on every machine.
+func hashValue(h hash.Hash64, v reflect.Value, depth int) {
+	if depth > maxHashDepth || !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			hashUint64(h, 1)
+		} else {
+			hashUint64(h, 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		hashUint64(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		hashUint64(h, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		hashFloat(h, v.Float())
+	case reflect.String:
+		h.Write([]byte(v.String()))
+	case reflect.Array, reflect.Slice:
+		hashUint64(h, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i), depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(h, v.Field(i), depth+1)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			hashUint64(h, 0)
+			return
+		}
+		h.Write([]byte(v.Elem().Type().String()))
+		hashValue(h, v.Elem(), depth+1)
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Sort(sortableKeys(keys))
+		hashUint64(h, uint64(len(keys)))
+		for _, key := range keys {
+			hashValue(h, key, depth+1)
+			hashValue(h, v.MapIndex(key), depth+1)
+		}
+	}
+}
+
+// Only supports the kinds of keys that are actually used in game state.
+type sortableKeys []reflect.Value
+
+func (s sortableKeys) Len() int      { return len(s) }
+func (s sortableKeys) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortableKeys) Less(i, j int) bool {
+	switch s[i].Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return s[i].Int() < s[j].Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return s[i].Uint() < s[j].Uint()
+	case reflect.Float32, reflect.Float64:
+		return s[i].Float() < s[j].Float()
+	case reflect.String:
+		return s[i].String() < s[j].String()
+	}
+	return false
+}
@@ -32,12 +32,16 @@ type ControlPoint struct {
 	Targets []Gid
 }
 
+func init() {
+	RegisterType(&ControlPoint{})
+}
+
 func (g *Game) MakeControlPoints() {
 	var cps []*ControlPoint
 	for _, towerData := range g.Level.Room.Towers {
 		cp := ControlPoint{
 			BaseEnt: BaseEnt{
-				Abilities_: []Ability{ability_makers["spawnCreeps"](map[string]float64{})},
+				Abilities_: []Ability{g.makeAbility("spawnCreeps", map[string]float64{})},
 				Side_:      towerData.Side,
 				Position:   towerData.Pos,
 				Processes:  make(map[int]Process),
@@ -60,7 +64,7 @@ func (g *Game) MakeControlPoints() {
 			cp.Controller = towerData.Side
 			// Must do this after the call to AddEnt() because BindAi requires that
 			// the ent's Gid has been set
-			cp.BindAi("tower", g.local.Engine)
+			cp.BindAi("tower", g)
 		}
 	}
 
@@ -162,7 +166,7 @@ func (cp *ControlPoint) Think(g *Game) {
 			cp.Control = 1.0
 			cp.Controlled = true
 			if cp.ai == nil {
-				cp.BindAi("tower", g.local.Engine)
+				cp.BindAi("tower", g)
 			}
 		}
 	}
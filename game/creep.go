@@ -1,7 +1,6 @@
 package game
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/jota/base"
 	"github.com/runningwild/jota/stats"
 	"github.com/runningwild/linear"
@@ -18,7 +17,7 @@ func (c *CreepEnt) Type() EntType {
 }
 
 func init() {
-	gob.Register(&CreepEnt{})
+	RegisterType(&CreepEnt{})
 }
 func (c *CreepEnt) Think(g *Game) {
 	c.BaseEnt.Think(g)
@@ -54,16 +53,18 @@ func (g *Game) AddCreeps(pos linear.Vec2, count, side int, params map[string]int
 
 		c.Abilities_ = append(
 			c.Abilities_,
-			ability_makers["asplode"](map[string]float64{"startRadius": 40, "endRadius": 70, "durationThinks": 50, "dps": 5}))
+			g.makeAbility("asplode", map[string]float64{"startRadius": 40, "endRadius": 70, "durationThinks": 50, "dps": 5}))
 
 		// if playerData.gid[0:2] == "Ai" {
-		//  c.BindAi("simple", g.local.Engine)
+		//  c.BindAi("simple", g)
 		// }
 
 		g.AddEnt(&c)
-		c.BindAi("creep", g.local.Engine)
-		for name, value := range params {
-			c.ai.SetParam(name, value)
+		c.BindAi("creep", g)
+		if c.ai != nil {
+			for name, value := range params {
+				c.ai.SetParam(name, value)
+			}
 		}
 	}
 }
@@ -0,0 +1,69 @@
+package game
+
+import (
+	"github.com/runningwild/jota/base"
+	"sort"
+)
+
+// A DeathRecord is added to Game.Deaths whenever a dead ent is removed from the
+// game.
+type DeathRecord struct {
+	Frame int
+	Gid   Gid
+	Side  int
+	Type  EntType
+
+	// The source of the most recent damage the ent took, and the ability it
+	// used.  Killer is empty if nobody was responsible, for example if the ent
+	// suicided without having taken any damage.
+	Killer        Gid
+	KillerAbility string
+
+	// Every other ent that damaged this one recently, ordered from most to least
+	// damage done.
+	Assists []Gid
+}
+
+func (g *Game) recordDeath(ent Ent) {
+	record := DeathRecord{
+		Frame: g.Frame,
+		Gid:   ent.Id(),
+		Side:  ent.Side(),
+		Type:  ent.Type(),
+	}
+	history := ent.Stats().DamageHistory()
+	if len(history) > 0 {
+		last := history[len(history)-1]
+		record.Killer = Gid(last.Source)
+		record.KillerAbility = last.Ability
+	}
+	damage := make(map[Gid]float64)
+	for _, dr := range history {
+		if Gid(dr.Source) != record.Killer {
+			damage[Gid(dr.Source)] += dr.Amt
+		}
+	}
+	for gid := range damage {
+		record.Assists = append(record.Assists, gid)
+	}
+	sort.Sort(assistSlice{record.Assists, damage})
+	g.Deaths = append(g.Deaths, record)
+	if record.Type == EntTypePlayer {
+		base.Log().Printf("%v killed by %v with %q, assisted by %v", record.Gid, record.Killer, record.KillerAbility, record.Assists)
+	}
+}
+
+type assistSlice struct {
+	gids   []Gid
+	damage map[Gid]float64
+}
+
+func (a assistSlice) Len() int      { return len(a.gids) }
+func (a assistSlice) Swap(i, j int) { a.gids[i], a.gids[j] = a.gids[j], a.gids[i] }
+func (a assistSlice) Less(i, j int) bool {
+	di, dj := a.damage[a.gids[i]], a.damage[a.gids[j]]
+	if di != dj {
+		return di > dj
+	}
+	return a.gids[i] < a.gids[j]
+}
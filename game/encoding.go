@@ -0,0 +1,299 @@
+package game
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Engines that join a game in progress are sent the whole Game, gob encoded,
+// and simulate from there.  Gob only encodes exported fields, so every Ability,
+// Process and Ent must keep all of its state in exported fields, and must be
+// registered with gob so that it can be sent as an interface.  The only
+// exceptions are the fields in localFields, which restoreDecoded rebuilds.
+
+// registeredTypes holds a value of every type registered with RegisterType.
+var registeredTypes []interface{}
+
+// RegisterType registers the type of v with gob so that it can be sent as an
+// interface, and keeps track of it so that tests can check that it survives
+// being sent.  Every Ability, Process, Ent and Mode should be registered this
+// way rather than with gob.Register.
+func RegisterType(v interface{}) {
+	gob.Register(v)
+	registeredTypes = append(registeredTypes, v)
+}
+
+// localFields are the unexported fields, as "Type.field", that hold data that
+// is specific to one engine or that can be rebuilt from the rest of the game.
+var localFields = map[string]bool{
+	"game.Game.local":      true,
+	"game.Game.editor":     true,
+	"game.Game.losCache":   true,
+	"game.SetupData.local": true,
+	"game.BaseEnt.ai":      true,
+}
+
+// Only types from this repo are checked for unexported fields, anything else
+// is assumed to know how to encode itself.
+const encodingCheckedPkg = "github.com/runningwild/jota"
+
+// Deep enough for the whole game, shallow enough to stop any cycles.
+const maxEncodingDepth = 20
+
+var gobEncoderType = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+
+// restoreDecoded rebuilds everything that isn't sent along with the game after
+// it has been decoded.
+func (g *Game) restoreDecoded() {
+	if g.Setup != nil || g.Level == nil {
+		return
+	}
+	if g.losCache == nil {
+		g.losCache = makeLosCache(g.Level.Room.Dx, g.Level.Room.Dy)
+	}
+	g.DoForEnts(func(gid Gid, ent Ent) {
+		if b, ok := baseEntOf(ent); ok {
+			b.relinkConditions()
+		}
+	})
+	g.local.temp.AllEntsDirty = true
+}
+
+// VerifyEncoding checks that the game can be sent to an engine that is joining
+// it in progress without losing anything.  It checks that nothing in the game
+// keeps state in unexported fields, that every ability any champion can have
+// survives being encoded and decoded, and that the checksum of the game is the
+// same after encoding and decoding it.  Returns an error describing all of the
+// problems found.
+func (g *Game) VerifyEncoding() error {
+	var problems []string
+	problems = append(problems, unencodedFields(reflect.ValueOf(g), "Game")...)
+	problems = append(problems, g.verifyAbilityEncoding()...)
+	problems = append(problems, g.verifyGameEncoding()...)
+	if len(problems) > 0 {
+		return fmt.Errorf("encoding problems:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// verifyAbilityEncoding makes every ability of every champion, as well as
+// every effect, and checks that each of them comes out of a round trip the
+// same as it went in.
+func (g *Game) verifyAbilityEncoding() []string {
+	var problems []string
+	for _, champ := range g.Champs {
+		if champ.ChampionDef == nil {
+			continue
+		}
+		for _, ab := range champ.Abilities {
+			maker, ok := ability_makers[ab.Name]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("champ %s: no ability named %q", champ.Defname, ab.Name))
+				continue
+			}
+			name := fmt.Sprintf("champ %s ability %s", champ.Defname, ab.Name)
+			problems = append(problems, verifyRoundTrip(name, maker(1, ab.Params))...)
+		}
+	}
+	var names []string
+	for name := range effect_makers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params := map[string]float64{"duration": 1}
+		problems = append(problems, verifyRoundTrip("effect "+name, effect_makers[name](params))...)
+	}
+	return problems
+}
+
+// encodedValue wraps values so that they are encoded as an interface, just like
+// they are when they are part of a Game.
+type encodedValue struct {
+	Value interface{}
+}
+
+// verifyRoundTrip checks that v has no unencoded fields, and encodes and
+// decodes it and compares the result to the original.  v is normalized before
+// comparing it, so it should be made just for the check.
+func verifyRoundTrip(name string, v interface{}) []string {
+	problems := unencodedFields(reflect.ValueOf(v), name)
+	var decoded encodedValue
+	if err := roundTrip(encodedValue{v}, &decoded); err != nil {
+		return append(problems, fmt.Sprintf("%s: %v", name, err))
+	}
+	if reflect.TypeOf(decoded.Value) != reflect.TypeOf(v) {
+		return append(problems, fmt.Sprintf("%s: decoded as a %T", name, decoded.Value))
+	}
+	want := reflect.ValueOf(&v).Elem()
+	got := reflect.ValueOf(&decoded.Value).Elem()
+	normalize(want, 0)
+	normalize(got, 0)
+	if !reflect.DeepEqual(want.Interface(), got.Interface()) {
+		problems = append(problems, fmt.Sprintf("%s: changed by encoding, %#v became %#v", name, want.Interface(), got.Interface()))
+	}
+	return problems
+}
+
+// verifyGameEncoding encodes and decodes the game and compares the checksums
+// of the original and the copy.
+func (g *Game) verifyGameEncoding() []string {
+	var decoded encodedValue
+	if err := roundTrip(encodedValue{g}, &decoded); err != nil {
+		return []string{fmt.Sprintf("Game: %v", err)}
+	}
+	decodedGame, ok := decoded.Value.(*Game)
+	if !ok {
+		return []string{fmt.Sprintf("Game: decoded as a %T", decoded.Value)}
+	}
+	decodedGame.restoreDecoded()
+	if g.Setup != nil || g.Level == nil {
+		return nil
+	}
+	diff := g.Checksum().FirstDifference(decodedGame.Checksum())
+	if diff != "" {
+		return []string{fmt.Sprintf("Game: checksum changed by encoding, first difference: %s", diff)}
+	}
+	return nil
+}
+
+func roundTrip(v encodedValue, decoded *encodedValue) error {
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return fmt.Errorf("unable to encode: %v", err)
+	}
+	if err := gob.NewDecoder(buf).Decode(decoded); err != nil {
+		return fmt.Errorf("unable to decode: %v", err)
+	}
+	return nil
+}
+
+// normalize makes the parts of v that gob doesn't distinguish the same: empty
+// slices and maps, and pointers to zero values, all become nil.
+func normalize(v reflect.Value, depth int) {
+	if depth > maxEncodingDepth || !v.CanSet() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		normalize(v.Elem(), depth+1)
+		if isZero(v.Elem()) {
+			v.Set(reflect.Zero(v.Type()))
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		normalize(elem, depth+1)
+		v.Set(elem)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			normalize(v.Index(i), depth+1)
+		}
+	case reflect.Slice:
+		if v.Len() == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			normalize(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		if v.Len() == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			normalize(elem, depth+1)
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			normalize(v.Field(i), depth+1)
+		}
+	}
+}
+
+func isZero(v reflect.Value) bool {
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" || !isZero(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// unencodedFields returns a description of every unexported field in v, or in
+// anything it refers to, that isn't in localFields.  Each field is only listed
+// once, along with the path to the first place that it was found.
+func unencodedFields(v reflect.Value, path string) []string {
+	var problems []string
+	found := make(map[string]bool)
+	findUnencodedFields(v, path, 0, found, &problems)
+	return problems
+}
+
+func findUnencodedFields(v reflect.Value, path string, depth int, found map[string]bool, problems *[]string) {
+	if depth > maxEncodingDepth || !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			findUnencodedFields(v.Elem(), path, depth+1, found, problems)
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			findUnencodedFields(v.Index(i), fmt.Sprintf("%s[%d]", path, i), depth+1, found, problems)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Sort(valueSlice(keys))
+		for _, key := range keys {
+			findUnencodedFields(v.MapIndex(key), fmt.Sprintf("%s[%v]", path, key), depth+1, found, problems)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		if !strings.HasPrefix(t.PkgPath(), encodingCheckedPkg) {
+			return
+		}
+		if t.Implements(gobEncoderType) || reflect.PtrTo(t).Implements(gobEncoderType) {
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath == "" {
+				findUnencodedFields(v.Field(i), path+"."+field.Name, depth+1, found, problems)
+				continue
+			}
+			name := t.String() + "." + field.Name
+			if localFields[name] || found[name] {
+				continue
+			}
+			found[name] = true
+			*problems = append(*problems, fmt.Sprintf("%s.%s: unexported field %s is not encoded", path, field.Name, name))
+		}
+	}
+}
+
+// valueSlice sorts map keys by how they print, which is all that's needed to
+// list problems in the same order every time.
+type valueSlice []reflect.Value
+
+func (v valueSlice) Len() int           { return len(v) }
+func (v valueSlice) Less(i, j int) bool { return fmt.Sprint(v[i]) < fmt.Sprint(v[j]) }
+func (v valueSlice) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
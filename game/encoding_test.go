@@ -0,0 +1,123 @@
+package game_test
+
+import (
+	"encoding/gob"
+	"fmt"
+	_ "github.com/runningwild/jota/ability"
+	_ "github.com/runningwild/jota/ability/control_point"
+	_ "github.com/runningwild/jota/ability/creep"
+	_ "github.com/runningwild/jota/effects"
+	"github.com/runningwild/jota/game"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Deep enough to fill in every registered type, shallow enough to stop types
+// that refer to themselves.
+const maxFillDepth = 6
+
+var gobEncoderType = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+
+// checkRoundTrip checks that v has no unencoded fields and that it comes out
+// of being encoded and decoded the same as it went in.
+func checkRoundTrip(t *testing.T, name string, v interface{}) {
+	for _, problem := range game.VerifyRoundTrip(name, v) {
+		t.Error(problem)
+	}
+}
+
+// TestRegisteredTypesEncoding fills in every exported field of every
+// registered Ability, Process, Ent and Mode and round trips it.
+func TestRegisteredTypesEncoding(t *testing.T) {
+	for _, v := range game.RegisteredTypes() {
+		typ := reflect.TypeOf(v)
+		if typ.Kind() != reflect.Ptr {
+			t.Errorf("%v: registered types should be pointers", typ)
+			continue
+		}
+		filled := reflect.New(typ.Elem())
+		fill(filled.Elem(), 0)
+		checkRoundTrip(t, typ.String(), filled.Interface())
+	}
+}
+
+// TestMadeEncoding round trips every ability and effect as its maker makes it.
+func TestMadeEncoding(t *testing.T) {
+	abilities := game.AbilityMakers()
+	for _, name := range sortedKeys(abilities) {
+		checkRoundTrip(t, "ability "+name, abilities[name](1, map[string]float64{}))
+	}
+	effects := game.EffectMakers()
+	for _, name := range sortedKeys(effects) {
+		checkRoundTrip(t, "effect "+name, effects[name](map[string]float64{"duration": 1}))
+	}
+}
+
+// fill sets every exported field in v to something other than its zero value.
+// Interfaces are filled with the first registered type that implements them.
+func fill(v reflect.Value, depth int) {
+	if depth > maxFillDepth || !v.CanSet() {
+		return
+	}
+	t := v.Type()
+	if t.Implements(gobEncoderType) || reflect.PtrTo(t).Implements(gobEncoderType) {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(3 + depth))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(3 + depth))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5 + float64(depth))
+	case reflect.String:
+		v.SetString(fmt.Sprintf("value %d", depth))
+	case reflect.Ptr:
+		p := reflect.New(t.Elem())
+		fill(p.Elem(), depth+1)
+		v.Set(p)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), depth+1)
+		}
+	case reflect.Slice:
+		s := reflect.MakeSlice(t, 1, 1)
+		fill(s.Index(0), depth+1)
+		v.Set(s)
+	case reflect.Map:
+		m := reflect.MakeMap(t)
+		key := reflect.New(t.Key()).Elem()
+		fill(key, depth+1)
+		elem := reflect.New(t.Elem()).Elem()
+		fill(elem, depth+1)
+		m.SetMapIndex(key, elem)
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fill(v.Field(i), depth+1)
+		}
+	case reflect.Interface:
+		for _, registered := range game.RegisteredTypes() {
+			rt := reflect.TypeOf(registered)
+			if !rt.Implements(t) {
+				continue
+			}
+			p := reflect.New(rt.Elem())
+			fill(p.Elem(), depth+1)
+			v.Set(p)
+			return
+		}
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
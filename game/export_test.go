@@ -0,0 +1,18 @@
+package game
+
+// The encoding tests are in package game_test, since they import the packages
+// that register abilities and effects, and those packages import game.
+
+var VerifyRoundTrip = verifyRoundTrip
+
+func RegisteredTypes() []interface{} {
+	return registeredTypes
+}
+
+func AbilityMakers() map[string]AbilityMaker {
+	return ability_makers
+}
+
+func EffectMakers() map[string]EffectMaker {
+	return effect_makers
+}
@@ -8,10 +8,12 @@ import (
 	"github.com/runningwild/glop/util/algorithm"
 	"github.com/runningwild/jota/base"
 	"github.com/runningwild/jota/champ"
+	"github.com/runningwild/jota/ship"
 	"github.com/runningwild/jota/stats"
 	"github.com/runningwild/linear"
 	"math"
 	"path/filepath"
+	"sort"
 	"sync"
 )
 
@@ -76,8 +78,9 @@ type Ent interface {
 	// ent.  After Suicide() all calls to Dead() should return true.
 	Suicide()
 
-	// For applying move events
-	Move(angle, magnitude float64)
+	// For applying move events.  If face is set the ent turns towards angle
+	// even if magnitude is 0.
+	Move(angle, magnitude float64, face bool)
 
 	Id() Gid
 	SetId(Gid)
@@ -94,7 +97,7 @@ type Ent interface {
 
 	Abilities() []Ability
 
-	BindAi(name string, engine *cgf.Engine)
+	BindAi(name string, g *Game)
 }
 
 type EntType int
@@ -117,17 +120,37 @@ type Gid string
 type Level struct {
 	ManaSource ManaSource
 	Room       Room
+
+	// Name of the file in data/rooms that Room was loaded from.
+	Name string
 }
 
 type SetupPlayerData struct {
 	Side       int
 	ChampIndex int
+	ShipIndex  int
+
+	// The game can only start once every player is ready.
+	Ready bool
+
+	// Only used by bots, see SetupAddBot.
+	Script     string
+	Difficulty float64
+
+	// Set by SetupIdentify, this lets the engine rejoin as this player if it
+	// gets disconnected once the game has started.  Only the hash of the key
+	// is kept, see Rejoin.
+	KeyHash string
 }
 
 type localSetupData struct {
 	// Position of the cursor.
 	Index int
 
+	// True while a chat message is being typed, Chat is the message so far.
+	Typing bool
+	Chat   string
+
 	// Event handling and engine thinking can happen concurrently, so we need to
 	// be able to lock the local data.  Embedded for convenience.
 	sync.RWMutex
@@ -135,10 +158,42 @@ type localSetupData struct {
 
 // Used before the 'game' starts to choose sides and characters and whatnot.
 type SetupData struct {
-	EngineIds []int64                    // engine ids of the engines currently joined
+	EngineIds []int64                    // ids of every player on the engines currently joined
 	Players   map[int64]*SetupPlayerData // map from engineid to player data
 	Seed      int64                      // random seed
 
+	// Name of the file in data/rooms that will be loaded when the game starts.
+	Room string
+
+	// Name of the Mode the game will be played in.
+	Mode string
+
+	// If positive, no more than this many engines will be allowed to join as
+	// players.  Spectators aren't counted.
+	MaxPlayers int
+
+	// Engine ids of the engines currently joined, and how many players each one
+	// has beyond its first.
+	JoinedEngineIds []int64
+	LocalPlayers    map[int64]int
+
+	// Engines that have been kicked and can't rejoin.
+	Kicked []int64
+
+	// Engines that will watch the game rather than play in it, see
+	// SetupSpectate.
+	Spectators []int64
+
+	// Most recent lobby chat messages, oldest first.
+	Chat []ChatMessage
+
+	// Number of bots that have been added, the most recently added bot has the
+	// id -Bots.
+	Bots int64
+
+	// If true Ais are ticked once the game starts, see Game.DeterministicAi.
+	DeterministicAi bool
+
 	local localSetupData
 }
 
@@ -148,35 +203,19 @@ type SetupSetEngineIds struct {
 
 func (s SetupSetEngineIds) Apply(_g interface{}) {
 	g := _g.(*Game)
+	g.recordEvent(s)
 	if g.Setup == nil {
 		return
 	}
+	ids := g.Setup.withoutKicked(s.EngineIds)
 	g.Manager = -1
-	g.Setup.EngineIds = s.EngineIds
-	for _, id := range g.Setup.EngineIds {
+	for _, id := range ids {
 		if g.Manager == -1 || id < g.Manager {
 			g.Manager = id
 		}
-		if _, ok := g.Setup.Players[id]; !ok {
-			g.Setup.Players[id] = &SetupPlayerData{}
-		}
-	}
-	if len(g.Setup.EngineIds) > len(s.EngineIds) {
-		unused := make(map[int64]bool)
-		for _, id := range g.Setup.EngineIds {
-			unused[id] = true
-		}
-		for _, id := range s.EngineIds {
-			delete(unused, id)
-		}
-		var usedEngineIds []int64
-		for _, id := range g.Setup.EngineIds {
-			if !unused[id] {
-				usedEngineIds = append(usedEngineIds, id)
-			}
-		}
-		g.Setup.EngineIds = usedEngineIds
 	}
+	g.Setup.JoinedEngineIds = ids
+	g.Setup.updatePlayerIds()
 }
 func init() {
 	gob.Register(SetupSetEngineIds{})
@@ -189,6 +228,7 @@ type SetupChangeSides struct {
 
 func (s SetupChangeSides) Apply(_g interface{}) {
 	g := _g.(*Game)
+	g.recordEvent(s)
 	if g.Setup == nil {
 		return
 	}
@@ -208,6 +248,7 @@ func init() {
 }
 func (s SetupChampSelect) Apply(_g interface{}) {
 	g := _g.(*Game)
+	g.recordEvent(s)
 	if g.Setup == nil {
 		return
 	}
@@ -224,13 +265,68 @@ func (s SetupChampSelect) Apply(_g interface{}) {
 	}
 }
 
+type SetupShipSelect struct {
+	EngineId int64
+	Ship     int
+}
+
+func init() {
+	gob.Register(SetupShipSelect{})
+}
+func (s SetupShipSelect) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil {
+		return
+	}
+	sideData := g.Setup.Players[s.EngineId]
+	if sideData == nil {
+		return
+	}
+	sideData.ShipIndex += s.Ship
+	if sideData.ShipIndex < 0 {
+		sideData.ShipIndex = 0
+	}
+	if sideData.ShipIndex >= len(g.Ships) {
+		sideData.ShipIndex = len(g.Ships) - 1
+	}
+}
+
+type SetupRoomSelect struct {
+	Room int
+}
+
+func init() {
+	gob.Register(SetupRoomSelect{})
+}
+
+// Moves the selected room forward or backward through g.Rooms by s.Room,
+// wrapping around at either end.
+func (s SetupRoomSelect) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || len(g.Rooms) == 0 {
+		return
+	}
+	index := g.RoomIndex(g.Setup.Room)
+	if index == -1 {
+		index = 0
+	}
+	index = (index + s.Room) % len(g.Rooms)
+	if index < 0 {
+		index += len(g.Rooms)
+	}
+	g.Setup.Room = g.Rooms[index].Name
+}
+
 type SetupComplete struct {
 	Seed int64
 }
 
 func (u SetupComplete) Apply(_g interface{}) {
 	g := _g.(*Game)
-	if g.Setup == nil {
+	g.recordEvent(u)
+	if g.Setup == nil || !g.Setup.AllReady() {
 		return
 	}
 	sideCount := make(map[int]int)
@@ -252,22 +348,30 @@ func (u SetupComplete) Apply(_g interface{}) {
 			PlayerGid:  Gid(gid),
 			Side:       player.Side,
 			ChampIndex: player.ChampIndex,
+			Hangar:     g.makeHangar(player.ShipIndex),
+			Script:     player.Script,
+			Difficulty: player.Difficulty,
+			KeyHash:    player.KeyHash,
 		}
 	}
 
 	// Now that we have the information we can set up a lot of the local data for
-	// this engine's player.
+	// this engine's players.
 
 	if g.IsPlaying() {
-		g.local.Side = g.Engines[g.local.Engine.Id()].Side
-		g.local.Gid = g.Engines[g.local.Engine.Id()].PlayerGid
-		g.local.Data = g.Engines[g.local.Engine.Id()]
+		g.setupLocalPlayers()
 	}
 
-	var room Room
-	err := base.LoadJson(filepath.Join(base.GetDataDir(), "rooms/basic.json"), &room)
-	if err != nil {
-		base.Error().Fatalf("%v", err)
+	index := g.RoomIndex(g.Setup.Room)
+	if index == -1 {
+		base.Error().Fatalf("Unable to find room '%s'", g.Setup.Room)
+	}
+	room := g.Rooms[index].Room
+	// The editor can add walls to the level, so the level needs its own copy of
+	// the walls rather than sharing them with g.Rooms.
+	room.Walls = make(map[string]linear.Poly)
+	for name, poly := range g.Rooms[index].Room.Walls {
+		room.Walls[name] = poly
 	}
 	errs := room.Validate()
 	for _, err := range errs {
@@ -278,11 +382,13 @@ func (u SetupComplete) Apply(_g interface{}) {
 	}
 	g.Level = &Level{}
 	g.Level.Room = room
+	g.Level.Name = g.Setup.Room
 	g.Rng = cmwc.MakeGoodCmwc()
 	g.Rng.Seed(u.Seed)
 	g.Ents = make(map[Gid]Ent)
 	g.Friction = 0.97
 	g.losCache = makeLosCache(g.Level.Room.Dx, g.Level.Room.Dy)
+	g.DeterministicAi = g.Setup.DeterministicAi
 	sides := make(map[int][]int64)
 	var playerDatas []*PlayerData
 	base.DoOrdered(g.Engines, func(a, b int64) bool { return a < b }, func(id int64, data *PlayerData) {
@@ -294,6 +400,12 @@ func (u SetupComplete) Apply(_g interface{}) {
 	}
 	g.AddPlayers(playerDatas)
 
+	maker, ok := mode_makers[g.Setup.Mode]
+	if !ok {
+		base.Error().Fatalf("Unable to find mode '%s'", g.Setup.Mode)
+	}
+	g.Mode = maker(g)
+
 	g.MakeControlPoints()
 	g.Init()
 	base.Log().Printf("Nillifying g.Setup()")
@@ -307,35 +419,83 @@ type PlayerData struct {
 	// If the player's Ent is in the game then its Gid will match this one.
 	PlayerGid Gid
 
+	// Every ship this player owns, the one chosen during setup is first.
+	Hangar []HangarShip
+
+	// Index into Hangar of the ship that is currently in play, or -1 if the
+	// player doesn't have a ship in play.
+	Launched int
+
+	// Index into Hangar of the ship to launch next.  If that ship is still
+	// being repaired then the next ready ship after it is launched instead.
+	Selected int
+
 	// If positive, this is the number of frames remaining until the player
-	// respawns.
-	CountdownFrames int
+	// launches their next ship.
+	LaunchFrames int
 
 	Side int
 
 	// Index into the champs array of the champion that this player is using.
 	ChampIndex int
+
+	// If set this player is a bot controlled by this script.
+	Script     string
+	Difficulty float64
+
+	// Hash of the key that the engine controlling this player identified
+	// itself with during setup, see Rejoin.  Only set for the first player on
+	// an engine.
+	KeyHash string
 }
 
 // All of these values apply to the local player only
 type localGameData struct {
 	Engine    *cgf.Engine
-	Camera    cameraInfo
-	Gid       Gid
-	Side      int
 	Abilities []Ability
 
-	// As long as we're using the keyboard, this is to make sure we track the
-	// value of each key properly, so that you don't stop rotating left if you
-	// release the right key, for example.
-	Up, Down, Left, Right float64
+	// Every player on this engine, ordered by index.  This is empty until setup
+	// is complete.
+	Players []*localPlayerData
+
+	// The player whose input is being handled or whose view is being drawn.
+	// Embedded so that g.local.Gid, g.local.Side, etc. always refer to the
+	// right player.  This is never nil, before setup is complete it is a player
+	// that doesn't exist.
+	*localPlayerData
+
+	// Used when this engine has no players once setup is complete, see
+	// IsSpectating.
+	spectator spectatorData
 
-	// This is just a convenience, it points to the PlayerData in
-	// Game.Engines[thisEngineId]
-	Data *PlayerData
+	// Where every ent was at the start of the last frame, see
+	// recordInterpolation.
+	interpolation interpolationData
+
+	// How long Moves sent by this engine took to be applied.
+	inputDelay InputDelay
+
+	// Published at the end of every frame for scripts to look at, see
+	// Snapshot.
+	snapshot snapshotData
 
 	pathingData *PathingData
 
+	// If non-nil, all events applied to the game are recorded here.
+	recorder *Recorder
+
+	// Frames before which SetupIdentify and Rejoin shouldn't be sent again.
+	nextIdentifyFrame int
+	nextRejoinFrame   int
+
+	// Last connected engine ids sent by the host.
+	sentConnected []int64
+
+	// Checksums computed by this engine, by frame, and descriptions of all
+	// desyncs found by comparing them against other engines' checksums.
+	checksums map[int]*StateChecksum
+	desyncs   []string
+
 	// Event handling and engine thinking can happen concurrently, so we need to
 	// be able to lock the local data.  Embedded for convenience.
 	sync.RWMutex
@@ -377,6 +537,14 @@ type Game struct {
 	// Last Id assigned to anything
 	NextIdValue int
 
+	// Number of times Think() has been called.  Events are applied between
+	// Thinks, so this identifies when an event happened.
+	Frame int
+
+	// How often, in frames, engines compare checksums of the game state.  Zero
+	// disables the comparison.
+	ChecksumInterval int
+
 	Ents map[Gid]Ent
 
 	// List of data specific to players/computers
@@ -385,28 +553,69 @@ type Game struct {
 	// All effects that are not tied to a player.
 	Processes []Process
 
+	// Every ent that has died this game, in the order that they died.
+	Deaths []DeathRecord
+
+	// Decides the score and when the match ends.
+	Mode Mode
+
+	// Set once the match is over, after which the game no longer thinks.
+	Result *MatchResult
+
 	losCache *losCache
 
 	// Champion defs loaded from the data file.  These are set by the host and
 	// sent to clients to make debugging and tuning easier.
 	Champs []champ.Champion
 
+	// Ship defs loaded from the data file, these are sent to clients just like
+	// the champion defs.
+	Ships []ship.Ship
+
+	// Rooms loaded from the data directory, sorted by name.  Like Champs these
+	// are set by the host and sent to clients, so every engine plays in exactly
+	// the same room regardless of what is in its own data directory.
+	Rooms []NamedRoom
+
+	// Scripts that bots can be controlled by, see loadBotScripts.
+	BotScripts []string
+
+	// Ids of the engines connected to the host, sorted.  This is kept up to date
+	// by the host once setup is complete, see Rejoin.
+	Connected []int64
+
+	// If true Ais are ticked inside Think so that they always do the same thing
+	// in the same game, see TickedAi.
+	DeterministicAi bool
+
+	// Events sent by ticked Ais that haven't been applied yet, ordered by the
+	// frame they will be applied on.
+	PendingAiEvents []AiEvents
+
 	local  localGameData
 	editor editorData
 }
 
+// InitializeClientData is called on engines that have just been sent the game
+// by the host.
 func (g *Game) InitializeClientData() {
-	// TODO: Do something useful with this.
+	g.restoreDecoded()
 }
 
 // IsPlaying() returns true if this is a human player playing the game.  This
 // functions returns false if this is a host binary that is simply connecting
 // players together.
 func (g *Game) IsPlaying() bool {
+	if g.local.Engine == nil {
+		return false
+	}
 	return !g.local.Engine.IsHost() || g.IsManaging()
 }
 
 func (g *Game) IsManaging() bool {
+	if g.local.Engine == nil {
+		return false
+	}
 	return g.local.Engine.Id() == g.Manager
 }
 
@@ -414,6 +623,12 @@ func (g *Game) PathingData() *PathingData {
 	return g.local.pathingData
 }
 
+// AllEnts returns every ent in the order that they should be iterated in.  Ents
+// added during the current frame are not included.
+func (g *Game) AllEnts() []Ent {
+	return g.local.temp.AllEnts
+}
+
 func (g *Game) EntsInRange(pos linear.Vec2, dist float64) []Ent {
 	g.local.RLock()
 	defer g.local.RUnlock()
@@ -436,6 +651,11 @@ func MakeGame() *Game {
 	var g Game
 	g.Setup = &SetupData{}
 	g.Setup.Players = make(map[int64]*SetupPlayerData)
+	g.Setup.LocalPlayers = make(map[int64]int)
+	g.Setup.Room = "basic.json"
+	g.local.localPlayerData = &localPlayerData{}
+	g.Setup.Mode = "onslaught"
+	g.ChecksumInterval = 60
 
 	// NOTE: Obviously this isn't threadsafe, but I don't intend to be Init()ing
 	// multiple game objects at the same time.
@@ -450,9 +670,37 @@ func MakeGame() *Game {
 		base.GetObject("champs", &g.Champs[i])
 		base.Log().Printf("Champ %v has %v", name, g.Champs[i].Abilities)
 	}
+
+	base.RemoveRegistry("ships")
+	base.RegisterRegistry("ships", make(map[string]*ship.ShipDef))
+	base.RegisterAllObjectsInDir("ships", filepath.Join(base.GetDataDir(), "ships"), ".json", "json")
+
+	names = base.GetAllNamesInRegistry("ships")
+	g.Ships = make([]ship.Ship, len(names))
+	for i, name := range names {
+		g.Ships[i].Defname = name
+		base.GetObject("ships", &g.Ships[i])
+	}
+	if len(g.Ships) == 0 {
+		base.Error().Fatalf("No ships found in %s.", filepath.Join(base.GetDataDir(), "ships"))
+	}
+
+	g.Rooms = loadAllRooms(filepath.Join(base.GetDataDir(), "rooms"))
+	g.BotScripts = loadBotScripts()
 	return &g
 }
 
+// RoomIndex returns the index into g.Rooms of the room with the specified
+// name, or -1 if there is no such room.
+func (g *Game) RoomIndex(name string) int {
+	for i := range g.Rooms {
+		if g.Rooms[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
 func (g *Game) Init() {
 	msOptions := ManaSourceOptions{
 		NumSeeds:    20,
@@ -527,6 +775,17 @@ func (g *Game) AddEnt(ent Ent) {
 	g.local.temp.AllEntsDirty = true
 }
 
+// playerDataByGid returns the PlayerData of the player whose ent has the
+// specified gid, or nil if there is no such player.
+func (g *Game) playerDataByGid(gid Gid) *PlayerData {
+	for _, p := range g.Engines {
+		if p.PlayerGid == gid {
+			return p
+		}
+	}
+	return nil
+}
+
 // Give the gid of a Player ent (ai or engine) this will return that player's
 // side, or -1 if such a player does not exist.
 func (g *Game) GidToSide(gid Gid) int {
@@ -541,21 +800,41 @@ func (g *Game) GidToSide(gid Gid) int {
 func (g *Game) ThinkSetup() {
 	g.local.Lock()
 	defer g.local.Unlock()
+	if g.local.Engine == nil {
+		// Games without an engine, like ones being played back from a replay, get
+		// all of their setup from events.
+		return
+	}
+	g.thinkIdentify()
 	if g.local.Engine.IsHost() {
 		// Update the list of ids in case it's changed
 		ids := g.local.Engine.Ids()
-		for i := range ids {
-			if ids[i] == g.local.Engine.Id() {
-				ids[i] = ids[len(ids)-1]
-				ids = ids[0 : len(ids)-1]
-				break
+		sort.Sort(int64Slice(ids))
+		// Kicked engines and spectators don't take up any of the MaxPlayers, the
+		// engines that joined first get the places.
+		var players, spectators []int64
+		for _, id := range g.Setup.withoutKicked(ids) {
+			switch {
+			case id == g.local.Engine.Id():
+			case g.Setup.isSpectator(id):
+				spectators = append(spectators, id)
+			default:
+				players = append(players, id)
 			}
 		}
-		g.local.Engine.ApplyEvent(SetupSetEngineIds{ids})
+		if g.Setup.MaxPlayers > 0 && len(players) > g.Setup.MaxPlayers {
+			players = players[0:g.Setup.MaxPlayers]
+		}
+		g.local.Engine.ApplyEvent(SetupSetEngineIds{append(players, spectators...)})
 	} else if !g.IsManaging() {
-		for i, v := range g.Setup.EngineIds {
-			if v == g.local.Engine.Id() {
-				g.Setup.local.Index = i
+		// Players that aren't managing can only move the cursor between their own
+		// rows.
+		index := g.Setup.local.Index
+		if index >= len(g.Setup.EngineIds) || OwnerEngineId(g.Setup.EngineIds[index]) != g.local.Engine.Id() {
+			for i, v := range g.Setup.EngineIds {
+				if v == g.local.Engine.Id() {
+					g.Setup.local.Index = i
+				}
 			}
 		}
 	}
@@ -582,54 +861,34 @@ func (g *Game) ThinkGame() {
 		g.local.temp.WallCache.SetWalls(g.Level.Room.Dx, g.Level.Room.Dy, allWalls, 100)
 		g.local.temp.VisibleWallCache = &wallCache{}
 		g.local.temp.VisibleWallCache.SetWalls(g.Level.Room.Dx, g.Level.Room.Dy, allWalls, stats.LosPlayerHorizon)
-		g.local.pathingData = makePathingData(&g.Level.Room)
+		g.local.pathingData = makePathingData(&g.Level.Room, g.DeterministicAi)
 	}
 
-	// cache ent data
+	// cache ent data.  This is done before looking for dead ents, as well as
+	// after, so that engines that were just sent the game find the same dead
+	// ents as the engines that have been running it all along.
+	g.updateAllEnts()
 	for _, ent := range g.local.temp.AllEnts {
 		if ent.Dead() {
 			if _, ok := ent.(*PlayerEnt); ok {
-				var id int64
-				_, err := fmt.Sscanf(string(ent.Id()), "Engine:%d", &id)
-				if err != nil {
-					_, err = fmt.Sscanf(string(ent.Id()), "Ai:%d", &id)
-					id = -id // Ai's engine ids are negative
-				}
-				if err != nil {
-					base.Error().Printf("Unable to parse player id '%v'", ent.Id())
+				// Players can move to another engine when they rejoin, so they are
+				// found by their Gid rather than by the engine id it was made from.
+				if engineData := g.playerDataByGid(ent.Id()); engineData == nil {
+					base.Error().Printf("Unable to find the player data for player %v", ent.Id())
 				} else {
-					if engineData, ok := g.Engines[id]; ok {
-						if !ok {
-							base.Error().Printf("Unable to find engine %d for player %v", id, ent.Id())
-						} else {
-							engineData.CountdownFrames = 60 * 10
-							base.Log().Printf("%v died, counting down....", *engineData)
-						}
-					}
+					g.shipLost(engineData)
+					base.Log().Printf("%v lost a ship", engineData.PlayerGid)
 				}
 			}
+			g.recordDeath(ent)
 			ent.OnDeath(g)
 			g.RemoveEnt(ent.Id())
 		}
 	}
 
-	// Death countdown
-	base.DoOrdered(g.Engines, func(a, b int64) bool { return a < b }, func(_ int64, engineData *PlayerData) {
-		if engineData.CountdownFrames > 0 {
-			engineData.CountdownFrames--
-			if engineData.CountdownFrames == 0 {
-				g.AddPlayers([]*PlayerData{engineData})
-			}
-		}
-	})
+	g.thinkHangars()
 
-	if g.local.temp.AllEnts == nil || g.local.temp.AllEntsDirty {
-		g.local.temp.AllEnts = g.local.temp.AllEnts[0:0]
-		g.DoForEnts(func(gid Gid, ent Ent) {
-			g.local.temp.AllEnts = append(g.local.temp.AllEnts, ent)
-		})
-		g.local.temp.AllEntsDirty = false
-	}
+	g.updateAllEnts()
 	if g.local.temp.EntGrid == nil {
 		g.local.temp.EntGrid = MakeEntCache(g.Level.Room.Dx, g.Level.Room.Dy)
 	}
@@ -641,16 +900,12 @@ func (g *Game) ThinkGame() {
 	algorithm.Choose(&g.Processes, func(proc Process) bool { return !proc.Dead() })
 
 	// Advance players, check for collisions, add segments
-	eps := 1.0e-3
 	for _, ent := range g.local.temp.AllEnts {
 		ent.Think(g)
 		for _, ab := range ent.Abilities() {
 			ab.Think(ent, g)
 		}
-		pos := ent.Pos()
-		pos.X = clamp(pos.X, eps, float64(g.Level.Room.Dx)-eps)
-		pos.Y = clamp(pos.Y, eps, float64(g.Level.Room.Dy)-eps)
-		ent.SetPos(pos)
+		ent.SetPos(g.clampToRoom(ent.Pos()))
 	}
 
 	var nearby []Ent
@@ -680,7 +935,31 @@ func (g *Game) ThinkGame() {
 		}
 	}
 
-	g.Level.ManaSource.Think(g.Ents)
+	g.Level.ManaSource.Think(g.local.temp.AllEnts)
+	if g.Mode != nil {
+		g.Mode.Think(g)
+	}
+	g.thinkChecksum()
+}
+
+// clampToRoom returns the closest position to pos that is inside the room.
+func (g *Game) clampToRoom(pos linear.Vec2) linear.Vec2 {
+	eps := 1.0e-3
+	pos.X = clamp(pos.X, eps, float64(g.Level.Room.Dx)-eps)
+	pos.Y = clamp(pos.Y, eps, float64(g.Level.Room.Dy)-eps)
+	return pos
+}
+
+// updateAllEnts rebuilds the ordered list of ents if any have been added or
+// removed since it was last built.
+func (g *Game) updateAllEnts() {
+	if g.local.temp.AllEnts == nil || g.local.temp.AllEntsDirty {
+		g.local.temp.AllEnts = g.local.temp.AllEnts[0:0]
+		g.DoForEnts(func(gid Gid, ent Ent) {
+			g.local.temp.AllEnts = append(g.local.temp.AllEnts, ent)
+		})
+		g.local.temp.AllEntsDirty = false
+	}
 }
 
 func (g *Game) Think() {
@@ -688,9 +967,18 @@ func (g *Game) Think() {
 	switch {
 	case g.Setup != nil:
 		g.ThinkSetup()
+	case g.Result != nil:
+		// The match is over, nothing moves any more.
 	default:
+		g.applyAiEvents()
+		g.thinkConnections()
+		g.recordInterpolation()
 		g.ThinkGame()
+		g.thinkPrediction()
+		g.publishSnapshot()
+		g.thinkAis()
 	}
+	g.Frame++
 }
 
 // Returns true iff a has los to b, regardless of distance, except that nothing
@@ -713,6 +1001,10 @@ type Move struct {
 	Gid       Gid
 	Angle     float64
 	Magnitude float64
+
+	// If set the ent turns towards Angle even when Magnitude is 0, otherwise it
+	// only turns while it's moving.
+	Face bool
 }
 
 func init() {
@@ -721,6 +1013,8 @@ func init() {
 
 func (m Move) Apply(_g interface{}) {
 	g := _g.(*Game)
+	g.recordEvent(m)
+	g.confirmMove(m.Gid)
 	ent := g.Ents[m.Gid]
 	if ent == nil {
 		return
@@ -728,7 +1022,7 @@ func (m Move) Apply(_g interface{}) {
 	if ent.Id() != m.Gid {
 		base.Error().Printf("Move.Apply(): %v %v")
 	}
-	ent.Move(m.Angle, m.Magnitude)
+	ent.Move(m.Angle, m.Magnitude, m.Face)
 }
 
 // Utils
@@ -11,14 +11,15 @@ import (
 	"github.com/runningwild/glop/system"
 	"github.com/runningwild/jota/base"
 	g2 "github.com/runningwild/jota/gui"
+	"math"
 	"time"
 	// "github.com/runningwild/jota/stats"
 	"github.com/runningwild/jota/texture"
 	"github.com/runningwild/linear"
-	"path/filepath"
 )
 
 type cameraInfo struct {
+	regionPos  linear.Vec2
 	regionDims linear.Vec2
 	// Camera positions.  target is used for the invaders so that the camera can
 	// follow the players without being too jerky.
@@ -39,16 +40,17 @@ func (camera *cameraInfo) FocusRegion(g *Game, side int) {
 		max.X = float64(g.Level.Room.Dx)
 		max.Y = float64(g.Level.Room.Dy)
 	} else {
-		min.X = player.Pos().X - player.Stats().Vision()
-		min.Y = player.Pos().Y - player.Stats().Vision()
+		pos, _ := g.drawPosition(player)
+		min.X = pos.X - player.Stats().Vision()
+		min.Y = pos.Y - player.Stats().Vision()
 		if min.X < 0 {
 			min.X = 0
 		}
 		if min.Y < 0 {
 			min.Y = 0
 		}
-		max.X = player.Pos().X + player.Stats().Vision()
-		max.Y = player.Pos().Y + player.Stats().Vision()
+		max.X = pos.X + player.Stats().Vision()
+		max.Y = pos.Y + player.Stats().Vision()
 		if max.X > float64(g.Level.Room.Dx) {
 			max.X = float64(g.Level.Room.Dx)
 		}
@@ -70,6 +72,19 @@ func (camera *cameraInfo) FocusRegion(g *Game, side int) {
 	camera.approachTarget()
 }
 
+// screenToGame converts a position in window coordinates, like the cursor
+// position, into game coordinates using the camera's current position.
+func (camera *cameraInfo) screenToGame(x, y int) linear.Vec2 {
+	frac := linear.Vec2{
+		(float64(x) - camera.regionPos.X) / camera.regionDims.X,
+		(float64(y) - camera.regionPos.Y) / camera.regionDims.Y,
+	}
+	return linear.Vec2{
+		camera.current.mid.X - camera.current.dims.X/2 + frac.X*camera.current.dims.X,
+		camera.current.mid.Y + camera.current.dims.Y/2 - frac.Y*camera.current.dims.Y,
+	}
+}
+
 // zoom == 0 fits the level exactly into the viewing region
 func (camera *cameraInfo) StandardRegion(pos linear.Vec2, levelDims linear.Vec2) {
 	mid := pos
@@ -106,7 +121,10 @@ func (g *Game) SetSystem(sys system.System) {
 
 func (g *Game) SetEngine(engine *cgf.Engine) {
 	g.local.Engine = engine
-	if control.up == nil {
+	if g.local.localPlayerData == nil {
+		g.local.localPlayerData = &localPlayerData{}
+	}
+	if control.editor == nil {
 		hatUp := gin.In().GetKeyFlat(gin.ControllerHatSwitchUp, gin.DeviceTypeController, gin.DeviceIndexAny)
 		control.hat.up = gin.In().BindDerivedKey(
 			"menuUp",
@@ -150,21 +168,28 @@ func (g *Game) SetEngine(engine *cgf.Engine) {
 			gin.In().MakeBinding(gin.AnyReturn, nil, nil),
 		)
 
-		// TODO: This is thread-safe, don't worry, but it is dumb.
-		controllerUp := gin.In().GetKeyFlat(gin.ControllerAxis0Negative+1, gin.DeviceTypeController, gin.DeviceIndexAny)
-		control.up = gin.In().BindDerivedKey("upKey", gin.In().MakeBinding(controllerUp.Id(), nil, nil), gin.In().MakeBinding(gin.AnyKeyW, nil, nil))
-		controllerDown := gin.In().GetKeyFlat(gin.ControllerAxis0Positive+1, gin.DeviceTypeController, gin.DeviceIndexAny)
-		control.down = gin.In().BindDerivedKey("downKey", gin.In().MakeBinding(controllerDown.Id(), nil, nil), gin.In().MakeBinding(gin.AnyKeyS, nil, nil))
-		controllerLeft := gin.In().GetKeyFlat(gin.ControllerAxis0Negative, gin.DeviceTypeController, gin.DeviceIndexAny)
-		control.left = gin.In().BindDerivedKey("leftKey", gin.In().MakeBinding(controllerLeft.Id(), nil, nil), gin.In().MakeBinding(gin.AnyKeyA, nil, nil))
-		controllerRight := gin.In().GetKeyFlat(gin.ControllerAxis0Positive, gin.DeviceTypeController, gin.DeviceIndexAny)
-		control.right = gin.In().BindDerivedKey("rightKey", gin.In().MakeBinding(controllerRight.Id(), nil, nil), gin.In().MakeBinding(gin.AnyKeyD, nil, nil))
-		control.any = gin.In().BindDerivedKey(
-			"any",
-			gin.In().MakeBinding(control.up.Id(), nil, nil),
-			gin.In().MakeBinding(control.down.Id(), nil, nil),
-			gin.In().MakeBinding(control.left.Id(), nil, nil),
-			gin.In().MakeBinding(control.right.Id(), nil, nil))
+		control.hat.prevShip = gin.In().BindDerivedKey("menuPrevShip", gin.In().MakeBinding(gin.AnyKeyZ, nil, nil))
+		control.hat.nextShip = gin.In().BindDerivedKey("menuNextShip", gin.In().MakeBinding(gin.AnyKeyX, nil, nil))
+
+		keyMap := base.GetDefaultKeyMap()
+		control.hat.addLocalPlayer = keyMap["addLocalPlayer"]
+		control.hat.removeLocalPlayer = keyMap["removeLocalPlayer"]
+		control.hat.ready = keyMap["ready"]
+		control.hat.kick = keyMap["kick"]
+		control.hat.autoBalance = keyMap["autoBalance"]
+		control.hat.chat = keyMap["chat"]
+		control.hat.addBot = keyMap["addBot"]
+		control.hat.removeBot = keyMap["removeBot"]
+		control.hat.botScript = keyMap["botScript"]
+		control.hat.botDifficulty = keyMap["botDifficulty"]
+		control.hat.spectate = keyMap["spectate"]
+
+		control.spectator.next = keyMap["followNext"]
+		control.spectator.prev = keyMap["followPrev"]
+		control.spectator.freeCam = keyMap["freeCam"]
+		control.spectator.fullVision = keyMap["fullVision"]
+		control.spectator.zoomIn = keyMap["zoomIn"]
+		control.spectator.zoomOut = keyMap["zoomOut"]
 
 		control.editor = gin.In().GetKey(gin.AnyKeyE)
 	}
@@ -174,6 +199,9 @@ func (g *Game) SetEngine(engine *cgf.Engine) {
 }
 
 func (game *Game) HandleEventGroupSetup(group gin.EventGroup) {
+	if game.handleSetupChat(group) {
+		return
+	}
 	if found, event := group.FindEvent(control.hat.up.Id()); found && event.Type == gin.Press {
 		game.Setup.local.Lock()
 		defer game.Setup.local.Unlock()
@@ -185,29 +213,134 @@ func (game *Game) HandleEventGroupSetup(group gin.EventGroup) {
 	if found, event := group.FindEvent(control.hat.down.Id()); found && event.Type == gin.Press {
 		game.Setup.local.Lock()
 		defer game.Setup.local.Unlock()
-		if game.Setup.local.Index < len(game.Setup.EngineIds) {
+		if game.Setup.local.Index < game.setupStartRow() {
 			game.Setup.local.Index++
 		}
 		return
 	}
 
 	if found, event := group.FindEvent(control.hat.left.Id()); found && event.Type == gin.Press {
-		game.local.Engine.ApplyEvent(SetupChampSelect{game.local.Engine.Id(), -1})
+		if game.IsManaging() && game.Setup.local.Index == game.setupRoomRow() {
+			game.local.Engine.ApplyEvent(SetupRoomSelect{-1})
+		} else {
+			game.local.Engine.ApplyEvent(SetupChampSelect{game.setupCursorPlayer(), -1})
+		}
 		return
 	}
 	if found, event := group.FindEvent(control.hat.right.Id()); found && event.Type == gin.Press {
-		game.local.Engine.ApplyEvent(SetupChampSelect{game.local.Engine.Id(), 1})
+		if game.IsManaging() && game.Setup.local.Index == game.setupRoomRow() {
+			game.local.Engine.ApplyEvent(SetupRoomSelect{1})
+		} else {
+			game.local.Engine.ApplyEvent(SetupChampSelect{game.setupCursorPlayer(), 1})
+		}
+		return
+	}
+	if found, event := group.FindEvent(control.hat.prevShip.Id()); found && event.Type == gin.Press {
+		game.local.Engine.ApplyEvent(SetupShipSelect{game.setupCursorPlayer(), -1})
+		return
+	}
+	if found, event := group.FindEvent(control.hat.nextShip.Id()); found && event.Type == gin.Press {
+		game.local.Engine.ApplyEvent(SetupShipSelect{game.setupCursorPlayer(), 1})
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.addLocalPlayer); found && event.Type == gin.Press {
+		game.local.Engine.ApplyEvent(SetupAddLocalPlayer{game.local.Engine.Id()})
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.removeLocalPlayer); found && event.Type == gin.Press {
+		game.local.Engine.ApplyEvent(SetupRemoveLocalPlayer{game.local.Engine.Id()})
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.spectate); found && event.Type == gin.Press {
+		id := game.local.Engine.Id()
+		game.Setup.local.RLock()
+		spectating := game.Setup.isSpectator(id)
+		game.Setup.local.RUnlock()
+		game.local.Engine.ApplyEvent(SetupSpectate{id, !spectating})
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.ready); found && event.Type == gin.Press {
+		id := game.setupCursorPlayer()
+		game.Setup.local.RLock()
+		player := game.Setup.Players[id]
+		ready := player != nil && player.Ready
+		game.Setup.local.RUnlock()
+		game.local.Engine.ApplyEvent(SetupReady{id, !ready})
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.kick); found && event.Type == gin.Press {
+		game.Setup.local.RLock()
+		defer game.Setup.local.RUnlock()
+		if !game.canRunLobby() || game.Setup.local.Index >= len(game.Setup.EngineIds) {
+			return
+		}
+		owner := OwnerEngineId(game.Setup.EngineIds[game.Setup.local.Index])
+		if owner != game.local.Engine.Id() {
+			game.local.Engine.ApplyEvent(SetupKick{owner})
+		}
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.autoBalance); found && event.Type == gin.Press {
+		if game.canRunLobby() {
+			game.local.Engine.ApplyEvent(SetupAutoBalance{})
+		}
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.addBot); found && event.Type == gin.Press {
+		if game.canRunLobby() && len(game.BotScripts) > 0 {
+			game.local.Engine.ApplyEvent(SetupAddBot{
+				Side:       game.setupSmallestSide(),
+				Script:     game.BotScripts[0],
+				Difficulty: defaultBotDifficulty,
+			})
+		}
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.removeBot); found && event.Type == gin.Press {
+		if !game.canRunLobby() {
+			return
+		}
+		if id, ok := game.setupCursorBot(); ok {
+			game.local.Engine.ApplyEvent(SetupRemoveBot{id})
+		} else {
+			// Remove the most recently added bot that's still around.
+			game.Setup.local.RLock()
+			bots := game.Setup.BotIds()
+			game.Setup.local.RUnlock()
+			if len(bots) > 0 {
+				game.local.Engine.ApplyEvent(SetupRemoveBot{bots[len(bots)-1]})
+			}
+		}
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.botScript); found && event.Type == gin.Press {
+		if id, ok := game.setupCursorBot(); ok && game.canRunLobby() {
+			game.local.Engine.ApplyEvent(SetupBotScript{id, 1})
+		}
+		return
+	}
+	if found, event := findKeyEvent(group, control.hat.botDifficulty); found && event.Type == gin.Press {
+		if id, ok := game.setupCursorBot(); ok && game.canRunLobby() {
+			game.Setup.local.RLock()
+			difficulty := game.Setup.Players[id].Difficulty + botDifficultyStep
+			game.Setup.local.RUnlock()
+			if difficulty > 1 {
+				difficulty = 0
+			}
+			game.local.Engine.ApplyEvent(SetupBotDifficulty{id, difficulty})
+		}
 		return
 	}
 	if found, event := group.FindEvent(control.hat.enter.Id()); found && event.Type == gin.Press {
 		game.Setup.local.Lock()
 		defer game.Setup.local.Unlock()
-		if game.Setup.local.Index < len(game.Setup.EngineIds) {
-			id := game.Setup.EngineIds[game.Setup.local.Index]
-			side := (game.Setup.Players[id].Side + 1) % 2
-			game.local.Engine.ApplyEvent(SetupChangeSides{id, side})
-		} else {
-			if game.local.Engine.Id() == game.Manager || game.local.Engine.IsHost() {
+		if id, ok := game.setupRowPlayer(game.Setup.local.Index); ok {
+			if id >= 0 || game.canRunLobby() {
+				side := (game.Setup.Players[id].Side + 1) % 2
+				game.local.Engine.ApplyEvent(SetupChangeSides{id, side})
+			}
+		} else if game.Setup.local.Index == game.setupStartRow() {
+			if game.canRunLobby() && game.Setup.AllReady() {
 				game.local.Engine.ApplyEvent(SetupComplete{time.Now().UnixNano()})
 			}
 		}
@@ -215,6 +348,111 @@ func (game *Game) HandleEventGroupSetup(group gin.EventGroup) {
 	}
 }
 
+// setupSmallestSide returns the side with the fewest players and bots.
+func (g *Game) setupSmallestSide() int {
+	g.Setup.local.RLock()
+	defer g.Setup.local.RUnlock()
+	var counts [2]int
+	for _, player := range g.Setup.Players {
+		if player.Side >= 0 && player.Side < len(counts) {
+			counts[player.Side]++
+		}
+	}
+	if counts[1] < counts[0] {
+		return 1
+	}
+	return 0
+}
+
+// canRunLobby returns true if this engine can start the game, kick players and
+// auto-balance sides.
+func (g *Game) canRunLobby() bool {
+	return g.local.Engine.Id() == g.Manager || g.local.Engine.IsHost()
+}
+
+// handleSetupChat handles typing a chat message, returns true if the event
+// group was used for that and shouldn't be handled as anything else.
+func (g *Game) handleSetupChat(group gin.EventGroup) bool {
+	g.Setup.local.Lock()
+	defer g.Setup.local.Unlock()
+	if !g.Setup.local.Typing {
+		if found, event := findKeyEvent(group, control.hat.chat); found && event.Type == gin.Press {
+			g.Setup.local.Typing = true
+			g.Setup.local.Chat = ""
+			return true
+		}
+		return false
+	}
+	for _, event := range group.Events {
+		if event.Type != gin.Press || event.Key.Id().Device.Type != gin.DeviceTypeKeyboard {
+			continue
+		}
+		index := event.Key.Id().Index
+		switch {
+		case index == gin.Return:
+			g.Setup.local.Typing = false
+			if g.Setup.local.Chat != "" {
+				g.local.Engine.ApplyEvent(SetupChat{g.local.Engine.Id(), g.Setup.local.Chat})
+			}
+		case index == gin.Backspace:
+			if len(g.Setup.local.Chat) > 0 {
+				g.Setup.local.Chat = g.Setup.local.Chat[0 : len(g.Setup.local.Chat)-1]
+			}
+		case index >= 32 && index <= 126 && len(g.Setup.local.Chat) < maxChatLength:
+			g.Setup.local.Chat += string(byte(index))
+		}
+	}
+	return true
+}
+
+// setupCursorPlayer returns the id of the player under the cursor if that
+// player is on this engine, or is a bot and this engine runs the lobby,
+// otherwise it returns the id of this engine's first player.  Champ and ship
+// selection apply to this player.
+func (g *Game) setupCursorPlayer() int64 {
+	g.Setup.local.RLock()
+	defer g.Setup.local.RUnlock()
+	if id, ok := g.setupRowPlayer(g.Setup.local.Index); ok {
+		if OwnerEngineId(id) == g.local.Engine.Id() || (id < 0 && g.canRunLobby()) {
+			return id
+		}
+	}
+	return g.local.Engine.Id()
+}
+
+// setupCursorBot returns the id of the bot under the cursor, if there is one.
+func (g *Game) setupCursorBot() (int64, bool) {
+	g.Setup.local.RLock()
+	defer g.Setup.local.RUnlock()
+	id, ok := g.setupRowPlayer(g.Setup.local.Index)
+	return id, ok && id < 0
+}
+
+// The setup screen lists one row for each player, then one for each bot,
+// followed by the room row and then the start row.  Only the managing engine
+// can move its cursor past its own players' rows.
+func (g *Game) setupRowPlayer(row int) (int64, bool) {
+	if row < 0 {
+		return 0, false
+	}
+	if row < len(g.Setup.EngineIds) {
+		return g.Setup.EngineIds[row], true
+	}
+	bots := g.Setup.BotIds()
+	if row-len(g.Setup.EngineIds) < len(bots) {
+		return bots[row-len(g.Setup.EngineIds)], true
+	}
+	return 0, false
+}
+
+func (g *Game) setupRoomRow() int {
+	return len(g.Setup.EngineIds) + len(g.Setup.BotIds())
+}
+
+func (g *Game) setupStartRow() int {
+	return g.setupRoomRow() + 1
+}
+
 // Because we don't want Think() to be called by both cgf and gin, we put a
 // wrapper around Game so that the Think() method called by gin is caught and
 // is just a nop.
@@ -225,47 +463,286 @@ type GameEventHandleWrapper struct {
 func (GameEventHandleWrapper) Think() {}
 
 func (g *Game) HandleEventGroupGame(group gin.EventGroup) {
-	g.local.RLock()
-	defer g.local.RUnlock()
+	g.local.Lock()
+	defer g.local.Unlock()
 
 	if found, event := group.FindEvent(control.editor.Id()); found && event.Type == gin.Press {
 		g.editor.Toggle()
 		return
 	}
 
-	if found, _ := group.FindEvent(control.any.Id()); found {
-		dir := getControllerDirection(gin.DeviceId{gin.DeviceTypeController, gin.DeviceIndexAny})
-		g.local.Engine.ApplyEvent(&Move{
-			Gid:       g.local.Gid,
+	if g.IsSpectating() {
+		g.handleSpectatorInput(group)
+		return
+	}
+
+	for _, player := range g.local.Players {
+		controller := gin.DeviceIndexAny
+		if len(g.local.Players) > 1 {
+			controller = gin.DeviceIndex(player.Index)
+		}
+		g.handlePlayerInput(player, getControllerInput(controller), getKeyboardInput(player.Index), group)
+	}
+}
+
+func (g *Game) handleSpectatorInput(group gin.EventGroup) {
+	if found, event := findKeyEvent(group, control.spectator.next); found && event.Type == gin.Press {
+		g.spectateFollow(1)
+	}
+	if found, event := findKeyEvent(group, control.spectator.prev); found && event.Type == gin.Press {
+		g.spectateFollow(-1)
+	}
+	if found, event := findKeyEvent(group, control.spectator.freeCam); found && event.Type == gin.Press {
+		g.spectateFreeCam()
+	}
+	if found, event := findKeyEvent(group, control.spectator.fullVision); found && event.Type == gin.Press {
+		g.local.spectator.FullVision = !g.local.spectator.FullVision
+	}
+}
+
+// thinkFreeCam moves the free camera according to the keys that are currently
+// held down, it is called once per rendered frame.
+func (g *Game) thinkFreeCam() {
+	keys := getKeyboardInput(0)
+	speed := 0.01
+	delta := (linear.Vec2{
+		keyPressAmt(keys.right) - keyPressAmt(keys.left),
+		keyPressAmt(keys.down) - keyPressAmt(keys.up),
+	}).Scale(speed)
+	zoom := 1.0 + speed*(keyPressAmt(control.spectator.zoomOut)-keyPressAmt(control.spectator.zoomIn))
+	g.moveFreeCam(delta, zoom)
+}
+
+func (g *Game) handlePlayerInput(player *localPlayerData, pad *controllerInput, keys *keyboardInput, group gin.EventGroup) {
+	if player.Data != nil && len(player.Data.Hangar) > 0 {
+		delta := 0
+		if found, event := findKeyEvent(group, keys.prevShip); found && event.Type == gin.Press {
+			delta = -1
+		}
+		if found, event := findKeyEvent(group, keys.nextShip); found && event.Type == gin.Press {
+			delta = 1
+		}
+		if delta != 0 {
+			n := len(player.Data.Hangar)
+			id := LocalPlayerId(g.local.Engine.Id(), player.Index)
+			g.local.Engine.ApplyEvent(LaunchShip{id, (player.Data.Selected + delta + n) % n})
+			return
+		}
+	}
+
+	if found, event := findKeyEvent(group, keys.mouseAim); found && event.Type == gin.Press && player.Index == 0 {
+		player.MouseAim = !player.MouseAim
+		base.SetStoreVal("mouse aim", fmt.Sprintf("%t", player.MouseAim))
+	}
+
+	if found, _ := group.FindEvent(pad.any.Id()); found {
+		dir := pad.direction()
+		move := Move{
+			Gid:       player.Gid,
 			Angle:     dir.Angle(),
 			Magnitude: dir.Mag(),
-		})
+		}
+		g.local.Engine.ApplyEvent(&move)
+		g.predictMove(player, move)
+	} else {
+		g.handleKeyboardMove(player, keys, group)
 	}
 
-	// ability0Key := gin.In().GetKeyFlat(gin.ControllerButton0+2, gin.DeviceTypeController, gin.DeviceIndexAny)
-	// abilityTrigger := gin.In().GetKeyFlat(gin.ControllerButton0+1, gin.DeviceTypeController, gin.DeviceIndexAny)
-	buttons := []gin.Key{
-		gin.In().GetKeyFlat(gin.ControllerButton0+2, gin.DeviceTypeController, gin.DeviceIndexAny),
-		gin.In().GetKeyFlat(gin.ControllerButton0+3, gin.DeviceTypeController, gin.DeviceIndexAny),
-		gin.In().GetKeyFlat(gin.ControllerButton0+4, gin.DeviceTypeController, gin.DeviceIndexAny),
-		gin.In().GetKeyFlat(gin.ControllerButton0+5, gin.DeviceTypeController, gin.DeviceIndexAny),
-	}
-	abilityTrigger := gin.In().GetKeyFlat(gin.ControllerButton0+6, gin.DeviceTypeController, gin.DeviceIndexAny)
-	for i, button := range buttons {
+	for i, button := range pad.buttons {
 		foundButton, _ := group.FindEvent(button.Id())
-		foundTrigger, triggerEvent := group.FindEvent(abilityTrigger.Id())
+		foundTrigger, triggerEvent := group.FindEvent(pad.trigger.Id())
+		pressAmt := button.CurPressAmt()
+		trigger := foundTrigger && triggerEvent.Type == gin.Press
+		if i < len(keys.abilities) {
+			foundKey, _ := findKeyEvent(group, keys.abilities[i])
+			foundButton = foundButton || foundKey
+			if amt := keyPressAmt(keys.abilities[i]); amt > pressAmt {
+				pressAmt = amt
+			}
+		}
+		if found, event := findKeyEvent(group, keys.trigger); found {
+			foundTrigger = true
+			trigger = trigger || event.Type == gin.Press
+		}
 		// TODO: Check if any abilities are Active before sending events to other abilities.
 		if foundButton || foundTrigger {
 			g.local.Engine.ApplyEvent(UseAbility{
-				Gid:     g.local.Gid,
+				Gid:     player.Gid,
 				Index:   i,
-				Button:  button.CurPressAmt(),
-				Trigger: foundTrigger && triggerEvent.Type == gin.Press,
+				Button:  pressAmt,
+				Trigger: trigger,
 			})
 		}
 	}
 }
 
+// Controller bindings for one local player.
+type controllerInput struct {
+	up, down, left, right gin.Key
+
+	// Pressed whenever any of the directions are.
+	any gin.Key
+
+	buttons []gin.Key
+	trigger gin.Key
+}
+
+var controllers = make(map[gin.DeviceIndex]*controllerInput)
+
+// getControllerInput returns the bindings for the controller with the specified
+// index, which may be gin.DeviceIndexAny.
+func getControllerInput(index gin.DeviceIndex) *controllerInput {
+	if pad, ok := controllers[index]; ok {
+		return pad
+	}
+	var pad controllerInput
+	// TODO: This is thread-safe, don't worry, but it is dumb.
+	controllerUp := gin.In().GetKeyFlat(gin.ControllerAxis0Negative+1, gin.DeviceTypeController, index)
+	pad.up = gin.In().BindDerivedKey(fmt.Sprintf("upKey%d", index), gin.In().MakeBinding(controllerUp.Id(), nil, nil))
+	controllerDown := gin.In().GetKeyFlat(gin.ControllerAxis0Positive+1, gin.DeviceTypeController, index)
+	pad.down = gin.In().BindDerivedKey(fmt.Sprintf("downKey%d", index), gin.In().MakeBinding(controllerDown.Id(), nil, nil))
+	controllerLeft := gin.In().GetKeyFlat(gin.ControllerAxis0Negative, gin.DeviceTypeController, index)
+	pad.left = gin.In().BindDerivedKey(fmt.Sprintf("leftKey%d", index), gin.In().MakeBinding(controllerLeft.Id(), nil, nil))
+	controllerRight := gin.In().GetKeyFlat(gin.ControllerAxis0Positive, gin.DeviceTypeController, index)
+	pad.right = gin.In().BindDerivedKey(fmt.Sprintf("rightKey%d", index), gin.In().MakeBinding(controllerRight.Id(), nil, nil))
+	pad.any = gin.In().BindDerivedKey(
+		fmt.Sprintf("any%d", index),
+		gin.In().MakeBinding(pad.up.Id(), nil, nil),
+		gin.In().MakeBinding(pad.down.Id(), nil, nil),
+		gin.In().MakeBinding(pad.left.Id(), nil, nil),
+		gin.In().MakeBinding(pad.right.Id(), nil, nil))
+	for i := 2; i <= 5; i++ {
+		pad.buttons = append(pad.buttons, gin.In().GetKeyFlat(gin.ControllerButton0+gin.KeyIndex(i), gin.DeviceTypeController, index))
+	}
+	pad.trigger = gin.In().GetKeyFlat(gin.ControllerButton0+6, gin.DeviceTypeController, index)
+	controllers[index] = &pad
+	return &pad
+}
+
+// Queries the input system for the direction that this controller is moving in
+func (pad *controllerInput) direction() linear.Vec2 {
+	v := linear.Vec2{
+		axisControl(pad.right.CurPressAmt()) - axisControl(pad.left.CurPressAmt()),
+		axisControl(pad.down.CurPressAmt()) - axisControl(pad.up.CurPressAmt()),
+	}
+	if v.Mag2() > 1 {
+		v = v.Norm()
+	}
+	return v
+}
+
+// Keyboard bindings for one local player, taken from the default KeyMap (see
+// key_binds.json), where each player's bindings are prefixed with its index.
+// Any binding missing from the KeyMap is left nil.
+type keyboardInput struct {
+	up, down, left, right gin.Key
+
+	// "0-1" through "0-4", these work like the controller's ability buttons.
+	abilities []gin.Key
+
+	// Works like the controller's ability trigger.
+	trigger gin.Key
+
+	// Choose which ship in the hangar to launch next.
+	prevShip, nextShip gin.Key
+
+	// Toggles mouse aim, only the first player can use the mouse.
+	mouseAim gin.Key
+}
+
+var keyboards = make(map[int]*keyboardInput)
+
+func getKeyboardInput(index int) *keyboardInput {
+	if keys, ok := keyboards[index]; ok {
+		return keys
+	}
+	keyMap := base.GetDefaultKeyMap()
+	prefix := fmt.Sprintf("%d", index)
+	var keys keyboardInput
+	keys.up = keyMap[prefix+"up"]
+	keys.down = keyMap[prefix+"down"]
+	keys.left = keyMap[prefix+"left"]
+	keys.right = keyMap[prefix+"right"]
+	for i := 1; i <= 4; i++ {
+		keys.abilities = append(keys.abilities, keyMap[fmt.Sprintf("%s-%d", prefix, i)])
+	}
+	keys.trigger = keyMap[prefix+"trigger"]
+	keys.prevShip = keyMap[prefix+"prevShip"]
+	keys.nextShip = keyMap[prefix+"nextShip"]
+	keys.mouseAim = keyMap[prefix+"mouseAim"]
+	keyboards[index] = &keys
+	return &keys
+}
+
+// findKeyEvent is group.FindEvent() but is safe to call with an unbound key.
+func findKeyEvent(group gin.EventGroup, key gin.Key) (bool, gin.Event) {
+	if key == nil {
+		return false, gin.Event{}
+	}
+	return group.FindEvent(key.Id())
+}
+
+func keyPressAmt(key gin.Key) float64 {
+	if key == nil {
+		return 0
+	}
+	return key.CurPressAmt()
+}
+
+// handleKeyboardMove sends a Move event if the keyboard movement keys have
+// changed.  With mouse aim the player always turns towards the cursor and
+// up/down thrust forward and backward, otherwise the movement keys work like
+// the controller's stick.
+func (g *Game) handleKeyboardMove(player *localPlayerData, keys *keyboardInput, group gin.EventGroup) {
+	changed := false
+	for _, key := range []gin.Key{keys.up, keys.down, keys.left, keys.right} {
+		if found, _ := findKeyEvent(group, key); found {
+			changed = true
+		}
+	}
+	player.Up = keyPressAmt(keys.up)
+	player.Down = keyPressAmt(keys.down)
+	player.Left = keyPressAmt(keys.left)
+	player.Right = keyPressAmt(keys.right)
+
+	var move Move
+	move.Gid = player.Gid
+	if player.MouseAim {
+		ent := g.Ents[player.Gid]
+		if ent == nil || g.editor.sys == nil {
+			return
+		}
+		cursor := player.Camera.screenToGame(g.editor.sys.GetCursorPos())
+		pos, _ := g.drawPosition(ent)
+		move.Angle = cursor.Sub(pos).Angle()
+		move.Magnitude = player.Up - player.Down
+		move.Face = true
+	} else {
+		dir := linear.Vec2{player.Right - player.Left, player.Down - player.Up}
+		if dir.Mag2() > 1 {
+			dir = dir.Norm()
+		}
+		move.Angle = dir.Angle()
+		move.Magnitude = dir.Mag()
+	}
+
+	// The cursor can move without any key events, so with mouse aim this gets
+	// called on every event group and only sends a Move if it is different
+	// enough from the last one.
+	if !changed {
+		if !player.MouseAim {
+			return
+		}
+		last := player.lastKeyboardMove
+		if math.Abs(move.Magnitude-last.Magnitude) < 1e-3 && math.Abs(move.Angle-last.Angle) < 0.02 {
+			return
+		}
+	}
+	player.lastKeyboardMove = move
+	g.local.Engine.ApplyEvent(move)
+	g.predictMove(player, move)
+}
+
 func (g *Game) HandleEventGroup(group gin.EventGroup) {
 	g.local.Engine.Pause()
 	defer g.local.Engine.Unpause()
@@ -294,23 +771,35 @@ func axisControl(v float64) float64 {
 var control struct {
 	hat struct {
 		up, down, left, right, enter gin.Key
-	}
-	any, up, down, left, right gin.Key
 
-	// Debug/Dev mode
-	editor gin.Key
-}
+		// Cycles through ships during setup.
+		prevShip, nextShip gin.Key
 
-// Queries the input system for the direction that this controller is moving in
-func getControllerDirection(controller gin.DeviceId) linear.Vec2 {
-	v := linear.Vec2{
-		axisControl(control.right.CurPressAmt()) - axisControl(control.left.CurPressAmt()),
-		axisControl(control.down.CurPressAmt()) - axisControl(control.up.CurPressAmt()),
+		// Adds or removes another player on this engine, these come from the
+		// KeyMap and may be nil.
+		addLocalPlayer, removeLocalPlayer gin.Key
+
+		// Lobby controls, these come from the KeyMap and may be nil.  Only the
+		// managing engine or the host can kick or auto-balance.
+		ready, kick, autoBalance, chat gin.Key
+
+		// Adds, removes and configures bots, these come from the KeyMap and may
+		// be nil.  Only the managing engine or the host can use these.
+		addBot, removeBot, botScript, botDifficulty gin.Key
+
+		// Toggles whether this engine spectates, from the KeyMap and may be nil.
+		spectate gin.Key
 	}
-	if v.Mag2() > 1 {
-		v = v.Norm()
+
+	// Used while spectating, these come from the KeyMap and may be nil.  The
+	// free camera is moved with the first player's movement keys.
+	spectator struct {
+		next, prev, freeCam, fullVision gin.Key
+		zoomIn, zoomOut                 gin.Key
 	}
-	return v
+
+	// Debug/Dev mode
+	editor gin.Key
 }
 
 func (g *Game) RenderLocalSetup(region g2.Region) {
@@ -322,45 +811,105 @@ func (g *Game) RenderLocalSetup(region g2.Region) {
 	dict.RenderString("Engines:", size, y, 0, size, gui.Left)
 	for i, id := range g.Setup.EngineIds {
 		y += size
-		if id == g.local.Engine.Id() {
+		owned := OwnerEngineId(id) == g.local.Engine.Id()
+		if owned {
 			gui.SetFontColor(0.7, 0.7, 1, 1)
 		} else {
 			gui.SetFontColor(0.7, 0.7, 0.7, 1)
 		}
-		dataStr := fmt.Sprintf("Engine %d, Side %d, %s", id, g.Setup.Players[id].Side, g.Champs[g.Setup.Players[id].ChampIndex].Name)
+		player := g.Setup.Players[id]
+		name := fmt.Sprintf("Engine %d", OwnerEngineId(id))
+		if index := LocalPlayerIndex(id); index > 0 {
+			name = fmt.Sprintf("%s.%d", name, index)
+		}
+		dataStr := fmt.Sprintf("%s, Side %d, %s, %s", name, player.Side, g.Champs[player.ChampIndex].Name, g.Ships[player.ShipIndex].Name)
+		if player.Ready {
+			dataStr += ", Ready"
+		}
+		dict.RenderString(dataStr, size, y, 0, size, gui.Left)
+		if (g.IsManaging() || owned) && i == g.Setup.local.Index {
+			dict.RenderString(">", 50, y, 0, size, gui.Right)
+		}
+	}
+	for i, id := range g.Setup.BotIds() {
+		y += size
+		gui.SetFontColor(0.7, 1, 0.7, 1)
+		player := g.Setup.Players[id]
+		dataStr := fmt.Sprintf("Bot %d, Side %d, %s, %s, %s, %d%%", -id, player.Side, g.Champs[player.ChampIndex].Name, g.Ships[player.ShipIndex].Name, player.Script, int(player.Difficulty*100+0.5))
 		dict.RenderString(dataStr, size, y, 0, size, gui.Left)
-		if g.IsManaging() && i == g.Setup.local.Index {
+		if g.canRunLobby() && len(g.Setup.EngineIds)+i == g.Setup.local.Index {
 			dict.RenderString(">", 50, y, 0, size, gui.Right)
 		}
 	}
+	for _, id := range g.Setup.Spectators {
+		y += size
+		if id == g.local.Engine.Id() {
+			gui.SetFontColor(0.7, 0.7, 1, 1)
+		} else {
+			gui.SetFontColor(0.7, 0.7, 0.7, 1)
+		}
+		dict.RenderString(fmt.Sprintf("Engine %d, Spectating", id), size, y, 0, size, gui.Left)
+	}
 	y += size
 	gui.SetFontColor(0.7, 0.7, 0.7, 1)
+	dict.RenderString(fmt.Sprintf("Room: %s", g.Setup.Room), size, y, 0, size, gui.Left)
+	if g.IsManaging() && g.Setup.local.Index == g.setupRoomRow() {
+		dict.RenderString(">", 50, y, 0, size, gui.Right)
+	}
+	y += size
 	if g.IsManaging() {
-		dict.RenderString("Start!", size, y, 0, size, gui.Left)
-		if g.Setup.local.Index == len(g.Setup.EngineIds) {
+		if notReady := g.Setup.NotReady(); notReady > 0 {
+			dict.RenderString(fmt.Sprintf("Waiting for %d player(s) to be ready", notReady), size, y, 0, size, gui.Left)
+		} else {
+			dict.RenderString("Start!", size, y, 0, size, gui.Left)
+		}
+		if g.Setup.local.Index == g.setupStartRow() {
 			dict.RenderString(">", 50, y, 0, size, gui.Right)
 		}
 	}
+	if g.Setup.isKicked(g.local.Engine.Id()) {
+		y += size
+		gui.SetFontColor(1, 0.3, 0.3, 1)
+		dict.RenderString("You have been kicked from this game.", size, y, 0, size, gui.Left)
+	}
+
+	// Lobby chat
+	chatSize := size / 2
+	y += size
+	gui.SetFontColor(0.7, 0.7, 0.7, 1)
+	for _, msg := range g.Setup.Chat {
+		y += chatSize
+		dict.RenderString(fmt.Sprintf("Engine %d: %s", msg.EngineId, msg.Text), size, y, 0, chatSize, gui.Left)
+	}
+	if g.Setup.local.Typing {
+		y += chatSize
+		gui.SetFontColor(0.7, 0.7, 1, 1)
+		dict.RenderString(fmt.Sprintf("Say: %s_", g.Setup.local.Chat), size, y, 0, chatSize, gui.Left)
+	}
 }
 
 func (g *Game) RenderLosMask() {
+	if g.IsSpectating() && g.local.spectator.FullVision {
+		return
+	}
 	ent := g.Ents[g.local.Gid]
 	if ent == nil {
 		return
 	}
-	walls := g.local.temp.VisibleWallCache.GetWalls(int(ent.Pos().X), int(ent.Pos().Y))
+	pos, _ := g.drawPosition(ent)
+	walls := g.local.temp.VisibleWallCache.GetWalls(int(pos.X), int(pos.Y))
 	gl.Disable(gl.TEXTURE_2D)
 	gl.Color4ub(0, 0, 0, 255)
 	gl.Begin(gl.TRIANGLES)
 	for _, wall := range walls {
-		if wall.Right(ent.Pos()) {
+		if wall.Right(pos) {
 			continue
 		}
 		a := wall.P
-		b := ent.Pos().Sub(wall.P).Norm().Scale(-10000.0).Add(wall.P)
+		b := pos.Sub(wall.P).Norm().Scale(-10000.0).Add(wall.P)
 		mid := wall.P.Add(wall.Q).Scale(0.5)
-		c := ent.Pos().Sub(mid).Norm().Scale(-10000.0).Add(mid)
-		d := ent.Pos().Sub(wall.Q).Norm().Scale(-10000.0).Add(wall.Q)
+		c := pos.Sub(mid).Norm().Scale(-10000.0).Add(mid)
+		d := pos.Sub(wall.Q).Norm().Scale(-10000.0).Add(wall.Q)
 		e := wall.Q
 		gl.Vertex2d(gl.Double(a.X), gl.Double(a.Y))
 		gl.Vertex2d(gl.Double(b.X), gl.Double(b.Y))
@@ -376,7 +925,7 @@ func (g *Game) RenderLosMask() {
 	}
 	gl.End()
 	base.EnableShader("horizon")
-	base.SetUniformV2("horizon", "center", ent.Pos())
+	base.SetUniformV2("horizon", "center", pos)
 	base.SetUniformF("horizon", "horizon", float32(ent.Stats().Vision()))
 	gl.Begin(gl.QUADS)
 	dx := gl.Int(g.Level.Room.Dx)
@@ -464,10 +1013,18 @@ func (g *Game) renderBases() {
 func (g *Game) renderEntsAndAbilities() {
 	gl.Color4d(1, 1, 1, 1)
 	for _, ent := range g.local.temp.AllEnts {
+		// Ents draw themselves where they are, so move them to where they should
+		// be drawn instead, see drawPosition.
+		pos, angle := g.drawPosition(ent)
+		gl.PushMatrix()
+		gl.Translated(gl.Double(pos.X), gl.Double(pos.Y), 0)
+		gl.Rotated(gl.Double((angle-ent.Angle())*180/math.Pi), 0, 0, 1)
+		gl.Translated(gl.Double(-ent.Pos().X), gl.Double(-ent.Pos().Y), 0)
 		ent.Draw(g)
 		for _, ab := range ent.Abilities() {
 			ab.Draw(ent, g)
 		}
+		gl.PopMatrix()
 	}
 }
 
@@ -478,9 +1035,16 @@ func (g *Game) renderProcesses() {
 }
 
 func (g *Game) RenderLocalGame(region g2.Region) {
+	g.local.Camera.regionPos = linear.Vec2{float64(region.X), float64(region.Y)}
 	g.local.Camera.regionDims = linear.Vec2{float64(region.Dims.Dx), float64(region.Dims.Dy)}
 	// func (g *Game) renderLocalHelper(region g2.Region, local *LocalData, camera *cameraInfo, side int) {
-	g.local.Camera.FocusRegion(g, 0)
+	if g.IsSpectating() && g.local.spectator.Following == "" {
+		g.thinkFreeCam()
+		room := linear.Vec2{float64(g.Level.Room.Dx), float64(g.Level.Room.Dy)}
+		g.local.Camera.StandardRegion(g.local.spectator.FreeCamMid, room.Scale(g.local.spectator.FreeCamZoom))
+	} else {
+		g.local.Camera.FocusRegion(g, 0)
+	}
 	gl.MatrixMode(gl.PROJECTION)
 	gl.PushMatrix()
 	gl.LoadIdentity()
@@ -530,8 +1094,17 @@ func (g *Game) RenderLocal(region g2.Region) {
 	switch {
 	case g.Setup != nil:
 		g.RenderLocalSetup(region)
+	case g.Result != nil:
+		g.RenderLocalGame(region)
+		g.RenderLocalResult(region)
 	case !g.editor.Active():
 		g.RenderLocalGame(region)
+		if g.IsSpectating() {
+			g.renderSpectator(region)
+		} else {
+			g.renderHangar(region)
+			g.renderInputDelay(region)
+		}
 	case g.editor.Active():
 		g.RenderLocalEditor(region)
 	default:
@@ -539,6 +1112,110 @@ func (g *Game) RenderLocal(region g2.Region) {
 	}
 }
 
+// Shows who won and the final scores on top of the game once the match is over.
+func (g *Game) RenderLocalResult(region g2.Region) {
+	dict := base.GetDictionary("luxisr")
+	size := 40.0
+	x := float64(region.X) + size
+	y := float64(region.Y) + 100.0
+	gui.SetFontColor(1, 1, 1, 1)
+	switch {
+	case g.Result.Winner == -1:
+		dict.RenderString(fmt.Sprintf("Nobody wins: %s", g.Result.Reason), x, y, 0, size, gui.Left)
+	case g.Result.Winner == g.local.Side:
+		dict.RenderString(fmt.Sprintf("Victory! %s", g.Result.Reason), x, y, 0, size, gui.Left)
+	default:
+		dict.RenderString(fmt.Sprintf("Defeat!  Side %d: %s", g.Result.Winner, g.Result.Reason), x, y, 0, size, gui.Left)
+	}
+	size = 25.0
+	y += 2 * size
+	for side, score := range g.Result.Scores {
+		dict.RenderString(fmt.Sprintf("Side %d: %.0f points", side, score), x, y, 0, size, gui.Left)
+		y += size
+	}
+	y += size
+	for _, player := range g.Result.Players {
+		if player.Gid == g.local.Gid {
+			gui.SetFontColor(0.7, 0.7, 1, 1)
+		} else {
+			gui.SetFontColor(0.7, 0.7, 0.7, 1)
+		}
+		str := fmt.Sprintf("%s (side %d): %d/%d/%d", player.Gid, player.Side, player.Kills, player.Deaths, player.Assists)
+		dict.RenderString(str, x, y, 0, size, gui.Left)
+		y += size
+	}
+}
+
+// Lists the ships in the local player's hangar, marking the one that will be
+// launched next and how long the others have left until they are repaired.
+func (g *Game) renderHangar(region g2.Region) {
+	data := g.local.Data
+	if data == nil {
+		return
+	}
+	dict := base.GetDictionary("luxisr")
+	size := 20.0
+	y := float64(region.Y) + size
+	for i, ship := range data.Hangar {
+		status := "ready"
+		switch {
+		case i == data.Launched:
+			status = "launched"
+		case !ship.Ready():
+			status = fmt.Sprintf("repairing %ds", (ship.RepairFrames+59)/60)
+		}
+		if ship.Ready() {
+			gui.SetFontColor(0.7, 0.7, 1, 1)
+		} else {
+			gui.SetFontColor(0.7, 0.7, 0.7, 1)
+		}
+		x := float64(region.X) + size
+		dict.RenderString(fmt.Sprintf("%s: %s", g.Ships[ship.Ship].Name, status), x+size, y, 0, size, gui.Left)
+		if i == data.Selected && data.Launched == -1 {
+			dict.RenderString(">", x, y, 0, size, gui.Left)
+		}
+		y += size
+	}
+	if data.Launched == -1 && data.LaunchFrames > 0 {
+		gui.SetFontColor(1, 1, 1, 1)
+		dict.RenderString(fmt.Sprintf("Launching in %ds", (data.LaunchFrames+59)/60), float64(region.X)+size, y, 0, size, gui.Left)
+	}
+}
+
+// Shows how long this engine's moves have been taking to be applied, which is
+// how far behind the prediction the actual game is.  This is read directly
+// since rendering already holds the read lock on local.
+func (g *Game) renderInputDelay(region g2.Region) {
+	delay := g.local.inputDelay
+	if delay.Moves == 0 {
+		return
+	}
+	dict := base.GetDictionary("luxisr")
+	size := 15.0
+	x := float64(region.X) + size
+	y := float64(region.Y+region.Dy) - 2*size
+	average := time.Duration(delay.AverageFrames()*float64(FrameMs)) * time.Millisecond
+	gui.SetFontColor(0.7, 0.7, 0.7, 1)
+	dict.RenderString(fmt.Sprintf("Input delay: %v average, %v max", average, time.Duration(delay.MaxFrames)*FrameMs*time.Millisecond), x, y, 0, size, gui.Left)
+}
+
+// Shows who is being followed and whether line of sight is being ignored.
+func (g *Game) renderSpectator(region g2.Region) {
+	dict := base.GetDictionary("luxisr")
+	size := 20.0
+	x := float64(region.X) + size
+	y := float64(region.Y) + size
+	gui.SetFontColor(1, 1, 1, 1)
+	switch {
+	case g.local.spectator.Following == "":
+		dict.RenderString("Spectating: free camera", x, y, 0, size, gui.Left)
+	case g.local.spectator.FullVision:
+		dict.RenderString(fmt.Sprintf("Spectating: %s (side %d), full vision", g.local.spectator.Following, g.local.Side), x, y, 0, size, gui.Left)
+	default:
+		dict.RenderString(fmt.Sprintf("Spectating: %s (side %d)", g.local.spectator.Following, g.local.Side), x, y, 0, size, gui.Left)
+	}
+}
+
 func (p *PlayerEnt) Draw(game *Game) {
 	var t *texture.Data
 	var alpha gl.Ubyte
@@ -548,13 +1225,7 @@ func (p *PlayerEnt) Draw(game *Game) {
 		alpha = gl.Ubyte(255.0 * (1.0 - p.Stats().Cloaking()))
 	}
 	gl.Color4ub(255, 255, 255, alpha)
-	// if p.Id() == 1 {
-	t = texture.LoadFromPath(filepath.Join(base.GetDataDir(), "ships/ship.png"))
-	// } else if p.Id() == 2 {
-	// 	t = texture.LoadFromPath(filepath.Join(base.GetDataDir(), "ships/ship3.png"))
-	// } else {
-	// 	t = texture.LoadFromPath(filepath.Join(base.GetDataDir(), "ships/ship2.png"))
-	// }
+	t = texture.LoadFromPath(string(game.Ships[p.Ship].Texture))
 	t.RenderAdvanced(
 		p.Position.X-float64(t.Dx())/2,
 		p.Position.Y-float64(t.Dy())/2,
@@ -849,7 +1520,22 @@ func (gw *GameWindow) Draw(region g2.Region, style g2.StyleStack) {
 	// Note that since we do a READER lock on game.local we cannot do any writes
 	// to local data while rendering.
 	game.local.RLock()
-	game.RenderLocal(region)
+	players := game.local.Players
+	if game.Setup != nil || game.editor.Active() || len(players) <= 1 {
+		game.RenderLocal(region)
+	} else {
+		// Split-screen, each local player gets an equal slice of the window.
+		// Nothing else changes the current local player, so this is safe to do
+		// with just the read lock.
+		for i, player := range players {
+			sub := region
+			sub.Dx = region.Dx / len(players)
+			sub.X = region.X + i*sub.Dx
+			game.local.localPlayerData = player
+			game.RenderLocal(sub)
+		}
+		game.local.localPlayerData = players[0]
+	}
 	game.local.RUnlock()
 	gw.Engine.Unpause()
 }
@@ -20,4 +20,7 @@ func (ms *ManaSource) Draw(zoom float64, dx float64, dy float64) {}
 
 func (g *Game) SetEngine(engine *cgf.Engine) {
 	g.local.Engine = engine
+	if g.local.localPlayerData == nil {
+		g.local.localPlayerData = &localPlayerData{}
+	}
 }
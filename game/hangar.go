@@ -0,0 +1,109 @@
+package game
+
+import (
+	"encoding/gob"
+	"github.com/runningwild/jota/base"
+)
+
+// Every player owns a hangar with several ships in it.  When the ship a player
+// is flying is destroyed it goes back to the hangar to be repaired, and after
+// a short delay the player launches another ship that is ready.  A player only
+// has to wait around if every one of their ships is being repaired.
+
+// Frames between losing a ship and launching the next one.
+const launchDelayFrames = 60 * 2
+
+type HangarShip struct {
+	// Index into Game.Ships.
+	Ship int
+
+	// If positive, this is the number of frames remaining until this ship is
+	// repaired and can be launched again.
+	RepairFrames int
+}
+
+func (h HangarShip) Ready() bool {
+	return h.RepairFrames <= 0
+}
+
+// makeHangar gives a player one of every ship, starting with the one that they
+// chose during setup.
+func (g *Game) makeHangar(first int) []HangarShip {
+	hangar := make([]HangarShip, len(g.Ships))
+	for i := range hangar {
+		hangar[i].Ship = (first + i) % len(g.Ships)
+	}
+	return hangar
+}
+
+// NextReadyShip returns the index into p.Hangar of the first ready ship at or
+// after p.Selected, or -1 if every ship is being repaired.
+func (p *PlayerData) NextReadyShip() int {
+	for i := range p.Hangar {
+		index := (p.Selected + i) % len(p.Hangar)
+		if p.Hangar[index].Ready() {
+			return index
+		}
+	}
+	return -1
+}
+
+// LaunchShip chooses which ship in a player's hangar will be launched the next
+// time that player needs a ship.
+type LaunchShip struct {
+	EngineId int64
+	Hangar   int
+}
+
+func init() {
+	gob.Register(LaunchShip{})
+}
+
+func (l LaunchShip) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(l)
+	if g.Setup != nil {
+		return
+	}
+	player, ok := g.Engines[l.EngineId]
+	if !ok || l.Hangar < 0 || l.Hangar >= len(player.Hangar) {
+		return
+	}
+	player.Selected = l.Hangar
+}
+
+// shipLost sends the player's current ship back to the hangar for repairs.
+func (g *Game) shipLost(player *PlayerData) {
+	if player.Launched >= 0 && player.Launched < len(player.Hangar) {
+		ship := &player.Hangar[player.Launched]
+		ship.RepairFrames = g.Ships[ship.Ship].RepairFrames
+	}
+	player.Launched = -1
+	player.LaunchFrames = launchDelayFrames
+}
+
+// thinkHangars repairs ships and launches a new ship for every player that
+// doesn't have one in play.
+func (g *Game) thinkHangars() {
+	base.DoOrdered(g.Engines, func(a, b int64) bool { return a < b }, func(_ int64, player *PlayerData) {
+		for i := range player.Hangar {
+			if player.Hangar[i].RepairFrames > 0 {
+				player.Hangar[i].RepairFrames--
+			}
+		}
+		if player.Launched != -1 {
+			return
+		}
+		if player.LaunchFrames > 0 {
+			player.LaunchFrames--
+			return
+		}
+		next := player.NextReadyShip()
+		if next == -1 {
+			return
+		}
+		player.Selected = next
+		player.Launched = next
+		g.AddPlayers([]*PlayerData{player})
+	})
+}
@@ -10,6 +10,11 @@ type HeatSeeker struct {
 	HeatSeekerParams
 }
 
+func init() {
+	RegisterType(&HeatSeeker{})
+	RegisterType(&massCondition{})
+}
+
 type BaseEntParams struct {
 	Health float64
 	Mass   float64
@@ -110,7 +115,9 @@ func (hs *HeatSeeker) Dead() bool {
 
 func (hs *HeatSeeker) Asplode(g *Game) {
 	hs.Asploded = true
-	for _, ent := range g.Ents {
+	// Processes get ids from g.NextId(), so this must go through the ents in
+	// the same order on every engine.
+	for _, ent := range g.AllEnts() {
 		if ent == hs {
 			continue
 		}
@@ -2,7 +2,10 @@ package game
 
 import (
 	"fmt"
+	"github.com/runningwild/jota/base"
 	"github.com/runningwild/linear"
+	"path/filepath"
+	"sort"
 )
 
 type Room struct {
@@ -64,6 +67,41 @@ func (r *Room) ExistsClearLos(a, b linear.Vec2, epsilon float64) bool {
 	return true
 }
 
+// A NamedRoom is a Room along with the name of the file it was loaded from,
+// relative to the rooms directory.
+type NamedRoom struct {
+	Name string
+	Room Room
+}
+
+type namedRoomSlice []NamedRoom
+
+func (s namedRoomSlice) Len() int           { return len(s) }
+func (s namedRoomSlice) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s namedRoomSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// loadAllRooms loads every .json file in dir as a Room.  Rooms that fail to
+// load are logged and skipped.
+func loadAllRooms(dir string) []NamedRoom {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		base.Error().Printf("Unable to list rooms in '%s': %v", dir, err)
+		return nil
+	}
+	var rooms []NamedRoom
+	for _, path := range paths {
+		var room Room
+		err := base.LoadJson(path, &room)
+		if err != nil {
+			base.Error().Printf("Unable to load room '%s': %v", path, err)
+			continue
+		}
+		rooms = append(rooms, NamedRoom{Name: filepath.Base(path), Room: room})
+	}
+	sort.Sort(namedRoomSlice(rooms))
+	return rooms
+}
+
 type roomSideData struct {
 	Base linear.Vec2 // Position of the base for this side
 }
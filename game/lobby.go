@@ -0,0 +1,170 @@
+package game
+
+import (
+	"encoding/gob"
+	"github.com/runningwild/jota/base"
+)
+
+// Most chat messages kept in SetupData.Chat, older ones are dropped.
+const maxChatMessages = 10
+
+// Longest chat message allowed, longer messages are truncated.
+const maxChatLength = 100
+
+type ChatMessage struct {
+	EngineId int64
+	Text     string
+}
+
+type SetupReady struct {
+	EngineId int64
+	Ready    bool
+}
+
+// SetupKick removes an engine, and all of its players, from the game.  It
+// won't be let back in for as long as the game is in setup.
+type SetupKick struct {
+	EngineId int64
+}
+
+// SetupAutoBalance moves players between sides until neither side has more
+// than one player more than the other.
+type SetupAutoBalance struct{}
+
+type SetupChat struct {
+	EngineId int64
+	Text     string
+}
+
+func init() {
+	gob.Register(SetupReady{})
+	gob.Register(SetupKick{})
+	gob.Register(SetupAutoBalance{})
+	gob.Register(SetupChat{})
+}
+
+func (s SetupReady) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil {
+		return
+	}
+	player := g.Setup.Players[s.EngineId]
+	if player == nil {
+		return
+	}
+	player.Ready = s.Ready
+}
+
+func (s SetupKick) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || g.Setup.isKicked(s.EngineId) {
+		return
+	}
+	base.Log().Printf("Kicking engine %d", s.EngineId)
+	g.Setup.Kicked = append(g.Setup.Kicked, s.EngineId)
+	g.Setup.JoinedEngineIds = g.Setup.withoutKicked(g.Setup.JoinedEngineIds)
+	g.Setup.updatePlayerIds()
+	g.Manager = -1
+	for _, id := range g.Setup.JoinedEngineIds {
+		if g.Manager == -1 || id < g.Manager {
+			g.Manager = id
+		}
+	}
+}
+
+func (s SetupAutoBalance) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil {
+		return
+	}
+	sides := make(map[int][]int64)
+	sides[0] = nil
+	sides[1] = nil
+	base.DoOrdered(g.Setup.Players, func(a, b int64) bool { return a < b }, func(id int64, player *SetupPlayerData) {
+		sides[player.Side] = append(sides[player.Side], id)
+	})
+	for {
+		// Move the newest player on the largest side to the smallest side.
+		var largest, smallest int
+		first := true
+		base.DoOrdered(sides, func(a, b int) bool { return a < b }, func(side int, ids []int64) {
+			if first || len(ids) > len(sides[largest]) {
+				largest = side
+			}
+			if first || len(ids) < len(sides[smallest]) {
+				smallest = side
+			}
+			first = false
+		})
+		if len(sides[largest])-len(sides[smallest]) <= 1 {
+			return
+		}
+		ids := sides[largest]
+		id := ids[len(ids)-1]
+		sides[largest] = ids[0 : len(ids)-1]
+		sides[smallest] = append(sides[smallest], id)
+		g.Setup.Players[id].Side = smallest
+	}
+}
+
+func (s SetupChat) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || s.Text == "" {
+		return
+	}
+	text := s.Text
+	if len(text) > maxChatLength {
+		text = text[0:maxChatLength]
+	}
+	g.Setup.Chat = append(g.Setup.Chat, ChatMessage{EngineId: s.EngineId, Text: text})
+	if len(g.Setup.Chat) > maxChatMessages {
+		g.Setup.Chat = g.Setup.Chat[len(g.Setup.Chat)-maxChatMessages:]
+	}
+}
+
+// Kicked returns true if this engine was kicked from the game during setup.
+// The host can't close the connection to a single engine, so a kicked engine
+// should disconnect itself.
+func (g *Game) Kicked() bool {
+	return g.Setup != nil && g.local.Engine != nil && g.Setup.isKicked(g.local.Engine.Id())
+}
+
+func (s *SetupData) isKicked(engineId int64) bool {
+	for _, id := range s.Kicked {
+		if id == engineId {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutKicked returns the ids in ids that haven't been kicked.
+func (s *SetupData) withoutKicked(ids []int64) []int64 {
+	var kept []int64
+	for _, id := range ids {
+		if !s.isKicked(id) {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// NotReady returns the number of human players that aren't ready.  Ai players
+// are always ready.
+func (s *SetupData) NotReady() int {
+	count := 0
+	for _, id := range s.EngineIds {
+		if !s.Players[id].Ready {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *SetupData) AllReady() bool {
+	return s.NotReady() == 0
+}
@@ -0,0 +1,172 @@
+package game
+
+import (
+	"encoding/gob"
+	"github.com/runningwild/jota/base"
+)
+
+// A single engine can have several players, for split-screen play.  The first
+// player on an engine uses the engine's id as its player id, any others use
+// LocalPlayerId(engineId, index).  Those ids are used everywhere an engine id
+// would be, in SetupData.Players and Game.Engines for example.
+
+// Most players that can share one engine.
+const maxLocalPlayers = 4
+
+func LocalPlayerId(engineId int64, index int) int64 {
+	return engineId + int64(index)<<32
+}
+
+// OwnerEngineId returns the id of the engine that controls the player with the
+// specified id.  Ai players, which have negative ids, are their own owners.
+func OwnerEngineId(id int64) int64 {
+	if id < 0 {
+		return id
+	}
+	return id & (1<<32 - 1)
+}
+
+// LocalPlayerIndex returns index such that LocalPlayerId(OwnerEngineId(id),
+// index) == id.
+func LocalPlayerIndex(id int64) int {
+	if id < 0 {
+		return 0
+	}
+	return int(id >> 32)
+}
+
+// Everything specific to one of the players on this engine.
+type localPlayerData struct {
+	Gid    Gid
+	Side   int
+	Camera cameraInfo
+
+	// Index of this player on this engine, this decides which key bindings and
+	// which controller it uses.
+	Index int
+
+	// As long as we're using the keyboard, this is to make sure we track the
+	// value of each key properly, so that you don't stop rotating left if you
+	// release the right key, for example.
+	Up, Down, Left, Right float64
+
+	// If true the player turns towards the cursor when using the keyboard.
+	MouseAim bool
+
+	// Last Move sent because of keyboard or mouse input.
+	lastKeyboardMove Move
+
+	// Where this player's ent is predicted to be, see predictionData.
+	prediction predictionData
+
+	// This is just a convenience, it points to the PlayerData in
+	// Game.Engines for this player.
+	Data *PlayerData
+}
+
+type SetupAddLocalPlayer struct {
+	EngineId int64
+}
+
+type SetupRemoveLocalPlayer struct {
+	EngineId int64
+}
+
+func init() {
+	gob.Register(SetupAddLocalPlayer{})
+	gob.Register(SetupRemoveLocalPlayer{})
+}
+
+func (s SetupAddLocalPlayer) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || g.Setup.LocalPlayers[s.EngineId]+1 >= maxLocalPlayers {
+		return
+	}
+	if g.Setup.LocalPlayers == nil {
+		g.Setup.LocalPlayers = make(map[int64]int)
+	}
+	g.Setup.LocalPlayers[s.EngineId]++
+	g.Setup.updatePlayerIds()
+}
+
+func (s SetupRemoveLocalPlayer) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || g.Setup.LocalPlayers[s.EngineId] == 0 {
+		return
+	}
+	g.Setup.LocalPlayers[s.EngineId]--
+	if g.Setup.LocalPlayers[s.EngineId] == 0 {
+		delete(g.Setup.LocalPlayers, s.EngineId)
+	}
+	g.Setup.updatePlayerIds()
+}
+
+// updatePlayerIds rebuilds EngineIds from JoinedEngineIds and LocalPlayers,
+// leaving out spectators, and makes sure Players has an entry for exactly
+// those ids and any Ais.
+func (s *SetupData) updatePlayerIds() {
+	joined := make(map[int64]bool)
+	s.EngineIds = nil
+	for _, id := range s.JoinedEngineIds {
+		joined[id] = true
+		if s.isSpectator(id) {
+			continue
+		}
+		for i := 0; i <= s.LocalPlayers[id]; i++ {
+			s.EngineIds = append(s.EngineIds, LocalPlayerId(id, i))
+		}
+	}
+	for id := range s.LocalPlayers {
+		if !joined[id] {
+			delete(s.LocalPlayers, id)
+		}
+	}
+	var spectators []int64
+	for _, id := range s.Spectators {
+		if joined[id] {
+			spectators = append(spectators, id)
+		}
+	}
+	s.Spectators = spectators
+	if s.Players == nil {
+		s.Players = make(map[int64]*SetupPlayerData)
+	}
+	current := make(map[int64]bool)
+	for _, id := range s.EngineIds {
+		current[id] = true
+		if _, ok := s.Players[id]; !ok {
+			s.Players[id] = &SetupPlayerData{}
+		}
+	}
+	for id := range s.Players {
+		if id >= 0 && !current[id] {
+			delete(s.Players, id)
+		}
+	}
+}
+
+// setupLocalPlayers makes a localPlayerData for every player that belongs to
+// this engine, in order of their index.
+func (g *Game) setupLocalPlayers() {
+	g.local.Players = nil
+	base.DoOrdered(g.Engines, func(a, b int64) bool { return a < b }, func(id int64, data *PlayerData) {
+		if OwnerEngineId(id) != g.local.Engine.Id() {
+			return
+		}
+		index := LocalPlayerIndex(id)
+		g.local.Players = append(g.local.Players, &localPlayerData{
+			Gid:   data.PlayerGid,
+			Side:  data.Side,
+			Index: index,
+			Data:  data,
+
+			// There is only one mouse, so only the first player can aim with it.
+			MouseAim: index == 0 && base.GetStoreVal("mouse aim") == "true",
+		})
+	})
+	if len(g.local.Players) > 0 {
+		g.local.localPlayerData = g.local.Players[0]
+	}
+}
@@ -472,9 +472,52 @@ func (ms *ManaSource) supplyPlayers(td *thinkData, ents []Ent) {
 	}
 }
 
+// ManaNear returns the total mana of each color in the nodes within dist of
+// pos.
+func (ms *ManaSource) ManaNear(pos linear.Vec2, dist float64) Mana {
+	var mana Mana
+	distSquared := dist * dist
+	for x := range ms.nodes {
+		if len(ms.nodes[x]) == 0 || math.Abs(ms.nodes[x][0].X-pos.X) > dist {
+			continue
+		}
+		for y := range ms.nodes[x] {
+			node := &ms.nodes[x][y]
+			if pos.Sub(linear.MakeVec2(node.X, node.Y)).Mag2() > distSquared {
+				continue
+			}
+			for c := range mana {
+				mana[c] += node.Mana[c]
+			}
+		}
+	}
+	return mana
+}
+
+// copyNodes returns a copy of ms with its own nodes, so that it can be read
+// while ms keeps changing.
+func (ms *ManaSource) copyNodes() *ManaSource {
+	c := &ManaSource{options: ms.options, thinks: ms.thinks}
+	c.rawNodes = append([]node(nil), ms.rawNodes...)
+	c.nodes = make([][]node, len(ms.nodes))
+	for i := range ms.nodes {
+		rows := len(ms.nodes[i])
+		c.nodes[i] = c.rawNodes[i*rows : (i+1)*rows]
+	}
+	return c
+}
+
+// MaxDrainDistance returns how close an ent must be to a node to drain mana
+// from it.
+func (ms *ManaSource) MaxDrainDistance() float64 {
+	return ms.options.MaxDrainDistance
+}
+
 var globalThinkData thinkData
 
-func (ms *ManaSource) Think(ents map[Gid]Ent) {
+// Think regenerates mana and supplies it to ents.  ents must be in the same
+// order on every engine, since drains are split between them in that order.
+func (ms *ManaSource) Think(ents []Ent) {
 	ms.thinks++
 	// If regenerateMana takes too long we can just do it every other frame and
 	// have mana regen at twice the rate.  Should look just as good and will save
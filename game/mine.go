@@ -9,9 +9,16 @@ type Mine struct {
 	BaseEnt
 	Damage  float64
 	Trigger float64
+
+	// Gid of the ent that placed this mine, it gets credit for any damage done.
+	Owner Gid
+}
+
+func init() {
+	RegisterType(&Mine{})
 }
 
-func (g *Game) MakeMine(pos, vel linear.Vec2, health, mass, damage, trigger float64) {
+func (g *Game) MakeMine(owner Gid, pos, vel linear.Vec2, health, mass, damage, trigger float64) {
 	mine := Mine{
 		BaseEnt: BaseEnt{
 			Side_:    10,
@@ -20,6 +27,7 @@ func (g *Game) MakeMine(pos, vel linear.Vec2, health, mass, damage, trigger floa
 		},
 		Damage:  damage,
 		Trigger: trigger,
+		Owner:   owner,
 	}
 	mine.BaseEnt.StatsInst = stats.Make(stats.Base{
 		Health: health,
@@ -46,7 +54,7 @@ func (m *Mine) Think(g *Game) {
 	if m.Trigger <= 0 {
 		for _, ent := range g.local.temp.AllEnts {
 			if ent.Pos().Sub(m.Position).Mag() < prox {
-				ent.Stats().ApplyDamage(stats.Damage{stats.DamageFire, m.Damage})
+				ent.Stats().ApplyDamage(stats.Damage{Kind: stats.DamageFire, Amt: m.Damage, Source: string(m.Owner), Ability: "mine"})
 			}
 		}
 	}
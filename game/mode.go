@@ -0,0 +1,101 @@
+package game
+
+import (
+	"github.com/runningwild/jota/base"
+)
+
+// A Mode decides how a match is scored and when it is over.  The Mode is part
+// of the game state, so it must be deterministic and gob encodable, and any
+// implementation must be registered with gob.
+type Mode interface {
+	// Called at the end of every ThinkGame.  The Mode ends the match by calling
+	// g.EndMatch().
+	Think(g *Game)
+
+	// Returns the current score for side.
+	Score(side int) float64
+}
+
+type ModeMaker func(g *Game) Mode
+
+var mode_makers map[string]ModeMaker
+
+func RegisterMode(name string, maker ModeMaker) {
+	if mode_makers == nil {
+		mode_makers = make(map[string]ModeMaker)
+	}
+	mode_makers[name] = maker
+}
+
+func HasMode(name string) bool {
+	_, ok := mode_makers[name]
+	return ok
+}
+
+// Once the match has ended the Result is set and the game stops thinking.
+type MatchResult struct {
+	Frame int
+
+	// The side that won, or -1 if nobody did.
+	Winner int
+	Reason string
+
+	// Final score of each side, indexed by side.
+	Scores []float64
+
+	// Kills, deaths and assists for every player, ordered by Gid.
+	Players []PlayerResult
+}
+
+type PlayerResult struct {
+	Gid     Gid
+	Side    int
+	Kills   int
+	Deaths  int
+	Assists int
+}
+
+// EndMatch ends the match with winner as the winning side, or no winner if
+// winner is -1.  Only the first call to EndMatch has any effect.
+func (g *Game) EndMatch(winner int, reason string) {
+	if g.Result != nil {
+		return
+	}
+	result := MatchResult{
+		Frame:  g.Frame,
+		Winner: winner,
+		Reason: reason,
+	}
+	for side := range g.Level.Room.SideData {
+		score := 0.0
+		if g.Mode != nil {
+			score = g.Mode.Score(side)
+		}
+		result.Scores = append(result.Scores, score)
+	}
+	players := make(map[Gid]*PlayerResult)
+	base.DoOrdered(g.Engines, func(a, b int64) bool { return a < b }, func(_ int64, data *PlayerData) {
+		players[data.PlayerGid] = &PlayerResult{Gid: data.PlayerGid, Side: data.Side}
+	})
+	for _, death := range g.Deaths {
+		if death.Type != EntTypePlayer {
+			continue
+		}
+		if player, ok := players[death.Gid]; ok {
+			player.Deaths++
+		}
+		if player, ok := players[death.Killer]; ok && death.Killer != death.Gid {
+			player.Kills++
+		}
+		for _, gid := range death.Assists {
+			if player, ok := players[gid]; ok && gid != death.Gid {
+				player.Assists++
+			}
+		}
+	}
+	base.DoOrdered(players, func(a, b Gid) bool { return a < b }, func(_ Gid, player *PlayerResult) {
+		result.Players = append(result.Players, *player)
+	})
+	g.Result = &result
+	base.Log().Printf("Match over on frame %d, winner: %d (%s), scores: %v", g.Frame, winner, reason, result.Scores)
+}
@@ -0,0 +1,95 @@
+package game
+
+// OnslaughtMode is the standard point capture mode.  Each side earns points for
+// every control point it holds, and a side wins by controlling every point,
+// by holding a majority of the points for long enough, or by reaching the
+// score limit.
+type OnslaughtMode struct {
+	// Indexed by side.
+	Scores []float64
+
+	// The side that currently controls more than half of the points, or -1 if
+	// no side does, and how many frames it has done so without interruption.
+	MajoritySide   int
+	MajorityFrames int
+
+	// Zero disables either of these win conditions.
+	MajorityFramesToWin int
+	ScoreToWin          float64
+}
+
+func init() {
+	RegisterMode("onslaught", makeOnslaughtMode)
+	RegisterType(&OnslaughtMode{})
+}
+
+func makeOnslaughtMode(g *Game) Mode {
+	return &OnslaughtMode{
+		Scores:              make([]float64, len(g.Level.Room.SideData)),
+		MajoritySide:        -1,
+		MajorityFramesToWin: 60 * 60 * 3,
+		ScoreToWin:          1000,
+	}
+}
+
+func (m *OnslaughtMode) Score(side int) float64 {
+	if side < 0 || side >= len(m.Scores) {
+		return 0
+	}
+	return m.Scores[side]
+}
+
+func (m *OnslaughtMode) Think(g *Game) {
+	counts := make([]int, len(m.Scores))
+	total := 0
+	for _, ent := range g.AllEnts() {
+		cp, ok := ent.(*ControlPoint)
+		if !ok {
+			continue
+		}
+		total++
+		if cp.Controlled && cp.Controller >= 0 && cp.Controller < len(counts) {
+			counts[cp.Controller]++
+		}
+	}
+	if total == 0 {
+		return
+	}
+
+	majority := -1
+	for side, count := range counts {
+		// One point per second for each control point.
+		m.Scores[side] += float64(count) / 60
+		if count == total {
+			g.EndMatch(side, "Controlled every point")
+			return
+		}
+		if 2*count > total {
+			majority = side
+		}
+	}
+
+	if majority != m.MajoritySide {
+		m.MajoritySide = majority
+		m.MajorityFrames = 0
+	}
+	if majority != -1 {
+		m.MajorityFrames++
+		if m.MajorityFramesToWin > 0 && m.MajorityFrames >= m.MajorityFramesToWin {
+			g.EndMatch(majority, "Held a majority of the points")
+			return
+		}
+	}
+
+	if m.ScoreToWin > 0 {
+		leader := -1
+		for side, score := range m.Scores {
+			if score >= m.ScoreToWin && (leader == -1 || score > m.Scores[leader]) {
+				leader = side
+			}
+		}
+		if leader != -1 {
+			g.EndMatch(leader, "Reached the score limit")
+		}
+	}
+}
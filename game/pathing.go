@@ -26,6 +26,12 @@ type PathingData struct {
 	// direct paths.  This way we don't block the initial Think() on doing all
 	// direct paths, which, until the ExistsLos() is faster, will be kinda slow.
 	finishDirectPaths sync.WaitGroup
+
+	// If set Dir always waits for the paths it needs rather than returning a
+	// straight line until they've been found in the background.  Ticked Ais
+	// need this, otherwise the paths they get depend on how fast the engine
+	// running them is.
+	synchronous bool
 }
 
 type pathingDstData struct {
@@ -52,16 +58,17 @@ type pathingNode struct {
 	dist       float64
 }
 
-func makePathingData(room *Room) *PathingData {
+func makePathingData(room *Room, synchronous bool) *PathingData {
 	start := time.Now()
 	defer func() {
 		base.Log().Printf("Pathing: %v", time.Now().Sub(start))
 	}()
 	var pd PathingData
+	pd.synchronous = synchronous
 	dx := (room.Dx + pathingDataGrid - 1) / pathingDataGrid
 	dy := (room.Dy + pathingDataGrid - 1) / pathingDataGrid
 	pd.finishDirectPaths.Add(dx * dy)
-	go func() {
+	alloc := func() {
 		pd.dirs = make([][][][]pathingDataCell, dx)
 		pd.conns = make([][][]pathingConnection, dx)
 		pd.dstData = make([][]pathingDstData, dx)
@@ -77,7 +84,12 @@ func makePathingData(room *Room) *PathingData {
 				go pd.findAllDirectPaths(i, j, room)
 			}
 		}
-	}()
+	}
+	if synchronous {
+		alloc()
+	} else {
+		go alloc()
+	}
 	return &pd
 }
 
@@ -159,6 +171,15 @@ func (pd *PathingData) Dir(src, dst linear.Vec2) linear.Vec2 {
 		return linear.Vec2{0, 0}
 	}
 	dstData := &pd.dstData[x2][y2]
+	if pd.synchronous {
+		dstData.once.Do(func() {
+			pd.finishDirectPaths.Wait()
+			dstData.Lock()
+			defer dstData.Unlock()
+			pd.findAllPaths(x2, y2)
+			dstData.complete = true
+		})
+	}
 	dstData.RLock()
 	defer dstData.RUnlock()
 	if !dstData.complete {
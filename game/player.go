@@ -1,7 +1,6 @@
 package game
 
 import (
-	"encoding/gob"
 	"github.com/runningwild/cgf"
 	"github.com/runningwild/jota/base"
 	"github.com/runningwild/jota/stats"
@@ -11,6 +10,9 @@ import (
 type PlayerEnt struct {
 	BaseEnt
 	Champ int
+
+	// Index into Game.Ships of the ship this player is flying.
+	Ship int
 }
 
 func (p *PlayerEnt) Type() EntType {
@@ -18,7 +20,7 @@ func (p *PlayerEnt) Type() EntType {
 }
 
 func init() {
-	gob.Register(&PlayerEnt{})
+	RegisterType(&PlayerEnt{})
 }
 
 func (p *PlayerEnt) Think(g *Game) {
@@ -38,7 +40,7 @@ func (p *PlayerEnt) Supply(mana Mana) Mana {
 func (g *Game) AddPlayers(players []*PlayerData) {
 	bySide := make(map[int][]addPlayerData)
 	for _, player := range players {
-		bySide[player.Side] = append(bySide[player.Side], addPlayerData{player.PlayerGid, player.ChampIndex})
+		bySide[player.Side] = append(bySide[player.Side], addPlayerData{player.PlayerGid, player.ChampIndex, player.Hangar[player.Launched].Ship, player.Script, player.Difficulty})
 	}
 	for side, players := range bySide {
 		g.addPlayersToSide(players, side)
@@ -46,8 +48,11 @@ func (g *Game) AddPlayers(players []*PlayerData) {
 }
 
 type addPlayerData struct {
-	gid   Gid
-	champ int
+	gid        Gid
+	champ      int
+	ship       int
+	script     string
+	difficulty float64
 }
 
 func (g *Game) addPlayersToSide(playerDatas []addPlayerData, side int) {
@@ -56,15 +61,13 @@ func (g *Game) addPlayersToSide(playerDatas []addPlayerData, side int) {
 	}
 	for i, playerData := range playerDatas {
 		var p PlayerEnt
-		p.StatsInst = stats.Make(stats.Base{
-			Health: 1000,
-			Mass:   750,
-			Acc:    150.0,
-			Turn:   0.07,
-			Rate:   0.5,
-			Size:   12,
-			Vision: 500,
-		})
+		champ := g.Champs[playerData.champ]
+		baseStats := g.Ships[playerData.ship].Stats
+		baseStats.Armor = baseStats.Armor.Add(champ.Armor)
+		baseStats.Resistance = baseStats.Resistance.Add(champ.Resistance)
+		p.StatsInst = stats.Make(baseStats)
+		p.Champ = playerData.champ
+		p.Ship = playerData.ship
 
 		// Evenly space the players on a circle around the starting position.
 		rot := (linear.Vec2{25, 0}).Rotate(float64(i) * 2 * 3.1415926535 / float64(len(playerDatas)))
@@ -74,21 +77,24 @@ func (g *Game) addPlayersToSide(playerDatas []addPlayerData, side int) {
 		p.Gid = playerData.gid
 		p.Processes = make(map[int]Process)
 
-		for _, ability := range g.Champs[playerData.champ].Abilities {
+		for _, ability := range champ.Abilities {
 			p.Abilities_ = append(
 				p.Abilities_,
-				ability_makers[ability.Name](ability.Params))
-		}
-
-		if playerData.gid[0:2] == "Ai" {
-			// p.BindAi("simple", g.local.Engine)
+				g.makeAbility(ability.Name, ability.Params))
 		}
 
 		g.AddEnt(&p)
+		if playerData.script != "" {
+			p.bindAiWithParams(playerData.script, g, map[string]interface{}{
+				"difficulty": playerData.difficulty,
+			})
+		}
 	}
 }
 
-type AiMaker func(name string, engine *cgf.Engine, gid Gid) Ai
+// An AiMaker makes an Ai that runs the script name to control the ent gid.  If
+// ticked is true the Ai must be a TickedAi.
+type AiMaker func(name string, engine *cgf.Engine, gid Gid, ticked bool) Ai
 
 var ai_maker AiMaker
 
@@ -101,4 +107,8 @@ type Ai interface {
 	Start()
 	Stop()
 	Terminate()
+
+	// Status returns what the Ai's script is doing.  It may be called from any
+	// goroutine.
+	Status() AiStatus
 }
@@ -0,0 +1,277 @@
+package game
+
+import (
+	"fmt"
+	"github.com/runningwild/linear"
+	"time"
+)
+
+// Every Move has to make it through the engine before it is applied to the
+// game, so on its own the local player's ship only responds to input after a
+// round trip.  To hide that each local player keeps a copy of its ent's
+// movement that Moves are applied to as soon as they are sent, and that is
+// advanced every frame with the same physics as the actual ent.  That copy is
+// what gets drawn.  Once a Move has been applied to the game the engine knows
+// how far behind the prediction the actual ent is, so it compares the actual
+// ent with what was predicted that many frames ago and moves the prediction by
+// any difference.  The drawn ship is then eased towards the corrected prediction
+// rather than jumping to it.  Every other ent is drawn interpolated between
+// where it was on the last two frames.
+
+// Milliseconds between frames, engines must be made with this frame rate.
+const FrameMs = 17
+
+const (
+	// Differences between the predicted and the actual ent smaller than this
+	// are ignored.
+	predictionTolerance = 0.5
+
+	// Differences larger than this, like when a ship respawns, are corrected
+	// immediately rather than smoothed.
+	predictionSnapDistance = 100.0
+
+	// Fraction of the remaining correction that is still left after a frame.
+	predictionSmoothing = 0.85
+
+	// Most frames that a Move can take to be applied before the prediction
+	// gives up on it and starts over from the actual ent.
+	maxPredictionFrames = 120
+)
+
+type predictionData struct {
+	// Movement of the player's ent, including every Move that has been sent.
+	// Only the position, velocity, angle and movement fields are kept up to
+	// date, everything else is copied from the actual ent every frame.
+	ent BaseEnt
+
+	// False until ent has been copied from the actual ent.
+	valid bool
+
+	// Moves that have been sent but not yet applied to the game, oldest
+	// first, and the number of Moves applied to the game since the last frame.
+	pending   []pendingMove
+	confirmed int
+
+	// Frames between the last Move applied to the game being sent and being
+	// applied.
+	lag int
+
+	// Recent states of ent, oldest first.
+	history []predictedState
+
+	// Offset from where ent is to where it is drawn, this shrinks every frame.
+	correction linear.Vec2
+}
+
+type pendingMove struct {
+	Frame int
+	Move  Move
+}
+
+type predictedState struct {
+	Frame    int
+	Position linear.Vec2
+	Velocity linear.Vec2
+}
+
+type interpolationData struct {
+	// Positions of every ent at the start of the last frame.
+	prev map[Gid]linear.Vec2
+
+	// When the last frame started.
+	frameStart time.Time
+}
+
+// predictMove applies move to the prediction for player, it should be called
+// whenever a Move is sent for a local player.
+func (g *Game) predictMove(player *localPlayerData, move Move) {
+	p := &player.prediction
+	p.pending = append(p.pending, pendingMove{Frame: g.Frame, Move: move})
+	if p.valid {
+		p.ent.Move(move.Angle, move.Magnitude, move.Face)
+	}
+}
+
+// confirmMove is called when a Move for gid is applied to the game.  Moves are
+// applied in the order they are sent, so this always confirms the oldest
+// pending one.
+func (g *Game) confirmMove(gid Gid) {
+	for _, player := range g.local.Players {
+		if player.Gid == gid {
+			player.prediction.confirmed++
+		}
+	}
+}
+
+// thinkPrediction advances and reconciles the prediction of every local
+// player.  It only changes local data, so it doesn't affect the game.
+func (g *Game) thinkPrediction() {
+	g.local.Lock()
+	defer g.local.Unlock()
+	for _, player := range g.local.Players {
+		player.prediction.think(g, player.Gid, &g.local.inputDelay)
+	}
+}
+
+func (p *predictionData) think(g *Game, gid Gid, delay *InputDelay) {
+	for ; p.confirmed > 0 && len(p.pending) > 0; p.confirmed-- {
+		p.lag = g.Frame - p.pending[0].Frame
+		p.pending = p.pending[1:]
+		delay.add(p.lag)
+	}
+	p.confirmed = 0
+	if len(p.pending) > 0 && g.Frame-p.pending[0].Frame > maxPredictionFrames {
+		// These were probably never applied, so stop waiting for them.
+		p.pending = p.pending[0:0]
+		p.valid = false
+	}
+	actual, ok := g.Ents[gid].(*PlayerEnt)
+	if !ok {
+		p.valid = false
+		return
+	}
+	if !p.valid {
+		p.snapTo(actual)
+		return
+	}
+
+	// Advance the prediction using the actual ent's stats, with the predicted
+	// movement.
+	next := actual.BaseEnt
+	next.Position = p.ent.Position
+	next.Velocity = p.ent.Velocity
+	next.Angle_ = p.ent.Angle_
+	next.Delta = p.ent.Delta
+	next.Target = p.ent.Target
+	next.thinkMovement(g)
+	next.Position = g.clampToRoom(next.Position)
+	p.ent = next
+	p.history = append(p.history, predictedState{g.Frame, p.ent.Position, p.ent.Velocity})
+	for len(p.history) > 0 && p.history[0].Frame < g.Frame-maxPredictionFrames {
+		p.history = p.history[1:]
+	}
+	p.correction = p.correction.Scale(predictionSmoothing)
+
+	// Moves reach the actual ent lag frames after they reach the prediction,
+	// and any Move that is still pending has been waiting at least that long.
+	lag := p.lag
+	if len(p.pending) > 0 && g.Frame-p.pending[0].Frame > lag {
+		lag = g.Frame - p.pending[0].Frame
+	}
+	past, ok := p.stateAt(g.Frame - lag)
+	if !ok {
+		return
+	}
+	diff := actual.Position.Sub(past.Position)
+	switch {
+	case diff.Mag() > predictionSnapDistance:
+		p.snapTo(actual)
+	case diff.Mag() > predictionTolerance:
+		velDiff := actual.Velocity.Sub(past.Velocity)
+		for i := range p.history {
+			p.history[i].Position = p.history[i].Position.Add(diff)
+			p.history[i].Velocity = p.history[i].Velocity.Add(velDiff)
+		}
+		p.ent.Position = g.clampToRoom(p.ent.Position.Add(diff))
+		p.ent.Velocity = p.ent.Velocity.Add(velDiff)
+		p.correction = p.correction.Sub(diff)
+	}
+}
+
+func (p *predictionData) stateAt(frame int) (predictedState, bool) {
+	for _, state := range p.history {
+		if state.Frame == frame {
+			return state, true
+		}
+	}
+	return predictedState{}, false
+}
+
+// snapTo starts the prediction over from the actual ent, applying whichever
+// Move was sent last.
+func (p *predictionData) snapTo(actual *PlayerEnt) {
+	p.ent = actual.BaseEnt
+	p.valid = true
+	p.history = p.history[0:0]
+	p.correction = linear.Vec2{}
+	if len(p.pending) > 0 {
+		move := p.pending[len(p.pending)-1].Move
+		p.ent.Move(move.Angle, move.Magnitude, move.Face)
+	}
+}
+
+// recordInterpolation remembers where every ent is before they are moved, so
+// that they can be drawn partway between there and where they end up.
+func (g *Game) recordInterpolation() {
+	if g.local.interpolation.prev == nil {
+		g.local.interpolation.prev = make(map[Gid]linear.Vec2)
+	}
+	for gid := range g.local.interpolation.prev {
+		if _, ok := g.Ents[gid]; !ok {
+			delete(g.local.interpolation.prev, gid)
+		}
+	}
+	for gid, ent := range g.Ents {
+		g.local.interpolation.prev[gid] = ent.Pos()
+	}
+	g.local.interpolation.frameStart = time.Now()
+}
+
+// drawPosition returns where ent should be drawn and at what angle.  Local
+// players are drawn where they are predicted to be, everything else is drawn
+// between where it was on the last two frames.
+func (g *Game) drawPosition(ent Ent) (linear.Vec2, float64) {
+	for _, player := range g.local.Players {
+		if player.Gid == ent.Id() && player.prediction.valid {
+			p := &player.prediction
+			return p.ent.Position.Add(p.correction), p.ent.Angle_
+		}
+	}
+	prev, ok := g.local.interpolation.prev[ent.Id()]
+	if !ok {
+		return ent.Pos(), ent.Angle()
+	}
+	frac := float64(time.Since(g.local.interpolation.frameStart)) / float64(FrameMs*time.Millisecond)
+	frac = clamp(frac, 0, 1)
+	return prev.Add(ent.Pos().Sub(prev).Scale(frac)), ent.Angle()
+}
+
+// InputDelay describes how many frames the Moves sent by the players on an
+// engine took to be applied to the game.
+type InputDelay struct {
+	Moves       int
+	TotalFrames int
+	MaxFrames   int
+}
+
+func (d *InputDelay) add(frames int) {
+	d.Moves++
+	d.TotalFrames += frames
+	if frames > d.MaxFrames {
+		d.MaxFrames = frames
+	}
+}
+
+func (d InputDelay) AverageFrames() float64 {
+	if d.Moves == 0 {
+		return 0
+	}
+	return float64(d.TotalFrames) / float64(d.Moves)
+}
+
+func (d InputDelay) String() string {
+	if d.Moves == 0 {
+		return "no moves applied"
+	}
+	average := time.Duration(d.AverageFrames() * float64(FrameMs*time.Millisecond))
+	return fmt.Sprintf("%d moves, %.1f frames (%v) on average, at most %d frames (%v)",
+		d.Moves, d.AverageFrames(), average, d.MaxFrames, time.Duration(d.MaxFrames)*FrameMs*time.Millisecond)
+}
+
+// InputDelay returns how long the Moves sent by this engine's players have
+// taken to be applied to the game so far.
+func (g *Game) InputDelay() InputDelay {
+	g.local.RLock()
+	defer g.local.RUnlock()
+	return g.local.inputDelay
+}
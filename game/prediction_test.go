@@ -0,0 +1,28 @@
+package game
+
+import (
+	"testing"
+)
+
+func TestInputDelay(t *testing.T) {
+	var d InputDelay
+	if d.AverageFrames() != 0 {
+		t.Errorf("Expected no delay before any moves, got %v", d.AverageFrames())
+	}
+	if s := d.String(); s != "no moves applied" {
+		t.Errorf("Expected %q, got %q", "no moves applied", s)
+	}
+	d.add(2)
+	d.add(6)
+	d.add(1)
+	if d.Moves != 3 || d.TotalFrames != 9 || d.MaxFrames != 6 {
+		t.Errorf("Expected 3 moves, 9 frames and at most 6, got %+v", d)
+	}
+	if d.AverageFrames() != 3 {
+		t.Errorf("Expected an average of 3 frames, got %v", d.AverageFrames())
+	}
+	expected := "3 moves, 3.0 frames (51ms) on average, at most 6 frames (102ms)"
+	if s := d.String(); s != expected {
+		t.Errorf("Expected %q, got %q", expected, s)
+	}
+}
@@ -0,0 +1,242 @@
+package game
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"github.com/runningwild/jota/base"
+	"sort"
+	"sync"
+)
+
+// An engine that gets disconnected from a game in progress can connect again
+// and take back control of its players.  It gets a new engine id when it
+// reconnects, so every client has a random key for each host it connects to
+// and during setup each engine identifies itself with a hash of that key.  Only the hash
+// becomes part of the game, so no other engine learns the key.  When an engine
+// without any players in a running game sends a Rejoin with a key that hashes
+// to the hash of an engine that is no longer connected, that engine's players
+// are moved to the new engine id.  The players keep their Gids, so their ents,
+// hangars and scores carry on as before.  Keys are kept in the store, so a
+// client that is restarted after a crash can still rejoin, see UseRejoinKey.
+
+// Frames to wait for a SetupIdentify or a Rejoin to be applied before sending
+// it again.
+const rejoinRetryFrames = 60
+
+// SetupIdentify sets the hash of the key that engine EngineId can use to rejoin
+// the game.
+type SetupIdentify struct {
+	EngineId int64
+	KeyHash  string
+}
+
+// SetConnectedEngines is sent by the host whenever the set of engines connected
+// to it changes after setup is complete.
+type SetConnectedEngines struct {
+	EngineIds []int64
+}
+
+// Rejoin moves the players of a disconnected engine that identified itself with
+// the hash of Key during setup to engine EngineId.
+type Rejoin struct {
+	EngineId int64
+	Key      string
+}
+
+func init() {
+	gob.Register(SetupIdentify{})
+	gob.Register(SetConnectedEngines{})
+	gob.Register(Rejoin{})
+}
+
+func (s SetupIdentify) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil {
+		return
+	}
+	player := g.Setup.Players[s.EngineId]
+	if player == nil {
+		return
+	}
+	player.KeyHash = s.KeyHash
+}
+
+func (s SetConnectedEngines) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	g.Connected = s.EngineIds
+}
+
+func (r Rejoin) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(r)
+	if g.Setup != nil || r.Key == "" || r.EngineId < 0 || g.ownsPlayers(r.EngineId) {
+		return
+	}
+	old := g.disconnectedEngine(hashRejoinKey(r.Key))
+	if old == -1 {
+		base.Warn().Printf("Engine %d tried to rejoin, but no disconnected engine has its key", r.EngineId)
+		return
+	}
+	var ids []int64
+	for id := range g.Engines {
+		if OwnerEngineId(id) == old {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(int64Slice(ids))
+	for _, id := range ids {
+		data := g.Engines[id]
+		delete(g.Engines, id)
+		g.Engines[LocalPlayerId(r.EngineId, LocalPlayerIndex(id))] = data
+		base.Log().Printf("Engine %d rejoined as %v", r.EngineId, data.PlayerGid)
+	}
+	if g.local.Engine != nil && g.local.Engine.Id() == r.EngineId {
+		g.setupLocalPlayers()
+	}
+}
+
+// disconnectedEngine returns the id of the engine that identified itself with
+// keyHash during setup, as long as it is no longer connected, or -1 if there is
+// no such engine.
+func (g *Game) disconnectedEngine(keyHash string) int64 {
+	engineId := int64(-1)
+	base.DoOrdered(g.Engines, func(a, b int64) bool { return a < b }, func(id int64, data *PlayerData) {
+		if engineId != -1 || id < 0 || data.KeyHash != keyHash || g.isConnected(OwnerEngineId(id)) {
+			return
+		}
+		engineId = OwnerEngineId(id)
+	})
+	return engineId
+}
+
+// ownsPlayers returns true if engine engineId controls any players.
+func (g *Game) ownsPlayers(engineId int64) bool {
+	for id := range g.Engines {
+		if OwnerEngineId(id) == engineId {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Game) isConnected(engineId int64) bool {
+	for _, id := range g.Connected {
+		if id == engineId {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejoin keys are kept in the store under this prefix followed by the host's
+// address and port.
+const storeRejoinKey = "rejoin key "
+
+var (
+	rejoinKeyMutex sync.Mutex
+	rejoinKey      string
+)
+
+// UseRejoinKey makes this process identify itself with its key for the game
+// hosted at addr:port.  The key is made and saved to the store the first time
+// a client connects to that host, after that the same key is used every time.
+func UseRejoinKey(addr string, port int) {
+	key := loadRejoinKey(addr, port)
+	rejoinKeyMutex.Lock()
+	defer rejoinKeyMutex.Unlock()
+	rejoinKey = key
+}
+
+// loadRejoinKey returns the key for the host at addr:port from the store,
+// making a new one if there isn't one yet.  Returns "" if a key couldn't be
+// made.
+func loadRejoinKey(addr string, port int) string {
+	name := fmt.Sprintf("%s%s:%d", storeRejoinKey, addr, port)
+	if key := base.GetStoreVal(name); key != "" {
+		return key
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		base.Error().Printf("Unable to make a rejoin key: %v", err)
+		return ""
+	}
+	key := hex.EncodeToString(buf)
+	base.SetStoreVal(name, key)
+	return key
+}
+
+// getRejoinKey returns the key this process identifies itself with, or "" if
+// UseRejoinKey hasn't been called.
+func getRejoinKey() string {
+	rejoinKeyMutex.Lock()
+	defer rejoinKeyMutex.Unlock()
+	return rejoinKey
+}
+
+func hashRejoinKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// thinkIdentify sends the hash of this engine's rejoin key during setup, until
+// it has been applied.
+func (g *Game) thinkIdentify() {
+	if g.local.Engine.IsHost() || g.Frame < g.local.nextIdentifyFrame {
+		return
+	}
+	id := g.local.Engine.Id()
+	player := g.Setup.Players[id]
+	if player == nil {
+		return
+	}
+	key := getRejoinKey()
+	if key == "" || player.KeyHash == hashRejoinKey(key) {
+		return
+	}
+	g.local.nextIdentifyFrame = g.Frame + rejoinRetryFrames
+	g.local.Engine.ApplyEvent(SetupIdentify{EngineId: id, KeyHash: hashRejoinKey(key)})
+}
+
+// thinkConnections keeps Connected up to date on the host, and has clients
+// without any players try to rejoin as a disconnected engine's players.
+func (g *Game) thinkConnections() {
+	if g.local.Engine == nil {
+		return
+	}
+	if g.local.Engine.IsHost() {
+		ids := g.local.Engine.Ids()
+		sort.Sort(int64Slice(ids))
+		if !sameIds(ids, g.local.sentConnected) {
+			g.local.sentConnected = ids
+			g.local.Engine.ApplyEvent(SetConnectedEngines{ids})
+		}
+		return
+	}
+	id := g.local.Engine.Id()
+	if g.ownsPlayers(id) || g.Frame < g.local.nextRejoinFrame {
+		return
+	}
+	key := getRejoinKey()
+	if key == "" || g.disconnectedEngine(hashRejoinKey(key)) == -1 {
+		return
+	}
+	g.local.nextRejoinFrame = g.Frame + rejoinRetryFrames
+	g.local.Engine.ApplyEvent(Rejoin{EngineId: id, Key: key})
+}
+
+func sameIds(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
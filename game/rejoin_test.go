@@ -0,0 +1,82 @@
+package game
+
+import (
+	"github.com/runningwild/jota/base"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// useTempStore points the store at a new temporary directory, and returns a
+// function that removes it.
+func useTempStore(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "jota-rejoin")
+	if err != nil {
+		t.Fatalf("Unable to make a temporary directory: %v", err)
+	}
+	base.SetDatadir(dir)
+	return func() { os.RemoveAll(dir) }
+}
+
+// forgetRejoinKey makes this process behave as if it was just started.
+func forgetRejoinKey() {
+	rejoinKeyMutex.Lock()
+	defer rejoinKeyMutex.Unlock()
+	rejoinKey = ""
+}
+
+func TestRejoinKeyIsKeptPerHost(t *testing.T) {
+	defer useTempStore(t)()
+	defer forgetRejoinKey()
+
+	UseRejoinKey("example.com", 20007)
+	key := getRejoinKey()
+	if key == "" {
+		t.Fatalf("Expected a rejoin key")
+	}
+	forgetRejoinKey()
+	UseRejoinKey("example.com", 20007)
+	if restarted := getRejoinKey(); restarted != key {
+		t.Errorf("Expected the same key %q after restarting, got %q", key, restarted)
+	}
+	UseRejoinKey("example.com", 20008)
+	if other := getRejoinKey(); other == key {
+		t.Errorf("Expected a different key for a different host, got %q for both", key)
+	}
+}
+
+func TestRejoinAfterRestart(t *testing.T) {
+	defer useTempStore(t)()
+	defer forgetRejoinKey()
+
+	// Engine 1 identified itself during setup and then crashed.
+	UseRejoinKey("example.com", 20007)
+	var g Game
+	g.Engines = map[int64]*PlayerData{
+		LocalPlayerId(0, 0): &PlayerData{PlayerGid: "host"},
+		LocalPlayerId(1, 0): &PlayerData{PlayerGid: "first", KeyHash: hashRejoinKey(getRejoinKey())},
+		LocalPlayerId(1, 1): &PlayerData{PlayerGid: "second"},
+	}
+	g.Connected = []int64{0, 2}
+
+	// The restarted client connected again as engine 2.
+	forgetRejoinKey()
+	UseRejoinKey("example.com", 20007)
+	Rejoin{EngineId: 3, Key: "wrong key"}.Apply(&g)
+	if g.ownsPlayers(3) {
+		t.Errorf("Expected a rejoin with the wrong key to be ignored")
+	}
+	Rejoin{EngineId: 2, Key: getRejoinKey()}.Apply(&g)
+	if g.ownsPlayers(1) {
+		t.Errorf("Expected engine 1 to have no players left")
+	}
+	for index, gid := range []Gid{"first", "second"} {
+		data := g.Engines[LocalPlayerId(2, index)]
+		if data == nil || data.PlayerGid != gid {
+			t.Errorf("Expected engine 2's player %d to be %v, got %v", index, gid, data)
+		}
+	}
+	if data := g.Engines[LocalPlayerId(0, 0)]; data == nil || data.PlayerGid != "host" {
+		t.Errorf("Expected the host's player to stay put, got %v", data)
+	}
+}
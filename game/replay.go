@@ -0,0 +1,221 @@
+package game
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/runningwild/jota/base"
+	"io"
+	"os"
+)
+
+// A replay is a snapshot of the Game taken during setup followed by every event
+// applied to it, each stamped with the frame it was applied on.  Since the
+// simulation is deterministic given the same events on the same frames, this
+// is enough to reproduce an entire match.
+
+// Event is anything that cgf can apply to a Game.
+type Event interface {
+	Apply(interface{})
+}
+
+const replayVersion = 3
+
+type replayHeader struct {
+	Version int
+
+	// Gob encoded Game as it was when recording started.  This is kept encoded
+	// so that a ReplayPlayer can decode it again whenever it needs to rewind.
+	Game []byte
+}
+
+type replayEvent struct {
+	Frame int
+
+	// A nil Event marks the end of the replay.
+	Event Event
+}
+
+// A Recorder writes a replay to disk as the game is played.  All methods must
+// be called while the engine is paused or from within an event or Think.
+type Recorder struct {
+	file *os.File
+	enc  *gob.Encoder
+}
+
+// StartRecording begins writing a replay of this game to path.  Recording can
+// only start during setup, since that is the only time the entire game state
+// is guaranteed to survive encoding.
+func (g *Game) StartRecording(path string) error {
+	if g.Setup == nil {
+		return fmt.Errorf("Can only start recording during setup.")
+	}
+	if g.local.recorder != nil {
+		return fmt.Errorf("Already recording.")
+	}
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(g)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	rec := &Recorder{file: f, enc: gob.NewEncoder(f)}
+	err = rec.enc.Encode(replayHeader{Version: replayVersion, Game: buf.Bytes()})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	g.local.recorder = rec
+	return nil
+}
+
+// StopRecording marks the end of the replay and closes the file.  It is safe to
+// call even if the game is not being recorded.
+func (g *Game) StopRecording() error {
+	rec := g.local.recorder
+	if rec == nil {
+		return nil
+	}
+	g.local.recorder = nil
+	err := rec.enc.Encode(replayEvent{Frame: g.Frame})
+	closeErr := rec.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// recordEvent should be called at the start of every event's Apply method.
+func (g *Game) recordEvent(event Event) {
+	rec := g.local.recorder
+	if rec == nil {
+		return
+	}
+	err := rec.enc.Encode(replayEvent{Frame: g.Frame, Event: event})
+	if err != nil {
+		base.Error().Printf("Unable to record event %v, recording stopped: %v", event, err)
+		g.local.recorder = nil
+		rec.file.Close()
+	}
+}
+
+// A ReplayPlayer re-applies a recorded replay to a fresh Game without an
+// engine.  No scripts are run during playback since everything the Ais did is
+// already in the replay.
+type ReplayPlayer struct {
+	header replayHeader
+	events []replayEvent
+	end    int
+
+	// Index into events of the next event to apply.
+	next int
+
+	game *Game
+}
+
+func LoadReplay(path string) (*ReplayPlayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := gob.NewDecoder(f)
+	var rp ReplayPlayer
+	err = dec.Decode(&rp.header)
+	if err != nil {
+		return nil, err
+	}
+	if rp.header.Version != replayVersion {
+		return nil, fmt.Errorf("Replay is version %d, expected version %d.", rp.header.Version, replayVersion)
+	}
+	rp.end = -1
+	for {
+		var event replayEvent
+		err = dec.Decode(&event)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The replay was never finished, probably because the recording engine
+			// crashed.  Everything up to here is still usable.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if event.Event == nil {
+			rp.end = event.Frame
+			break
+		}
+		rp.events = append(rp.events, event)
+	}
+	if rp.end == -1 && len(rp.events) > 0 {
+		rp.end = rp.events[len(rp.events)-1].Frame + 1
+	}
+	err = rp.rewind()
+	if err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
+
+func (rp *ReplayPlayer) rewind() error {
+	var g Game
+	err := gob.NewDecoder(bytes.NewBuffer(rp.header.Game)).Decode(&g)
+	if err != nil {
+		return err
+	}
+	if rp.end < g.Frame {
+		rp.end = g.Frame
+	}
+	rp.game = &g
+	rp.next = 0
+	return nil
+}
+
+// Game returns the game in its current state.  The returned value is
+// invalidated by any call to Seek that has to rewind.
+func (rp *ReplayPlayer) Game() *Game {
+	return rp.game
+}
+
+// Frame returns the number of frames the game has been run for.
+func (rp *ReplayPlayer) Frame() int {
+	return rp.game.Frame
+}
+
+// EndFrame returns the frame that the recording stopped on.
+func (rp *ReplayPlayer) EndFrame() int {
+	return rp.end
+}
+
+// Step applies all events for the current frame and then advances the game by
+// one frame.  Returns false if the end of the replay has been reached.
+func (rp *ReplayPlayer) Step() bool {
+	if rp.game.Frame >= rp.end {
+		return false
+	}
+	for rp.next < len(rp.events) && rp.events[rp.next].Frame <= rp.game.Frame {
+		rp.events[rp.next].Event.Apply(rp.game)
+		rp.next++
+	}
+	rp.game.Think()
+	return true
+}
+
+// Seek runs the game until it has been run for exactly frame frames, rewinding
+// to the beginning first if necessary.
+func (rp *ReplayPlayer) Seek(frame int) error {
+	if frame > rp.end {
+		return fmt.Errorf("Can't seek to frame %d, replay ends on frame %d.", frame, rp.end)
+	}
+	if frame < rp.game.Frame {
+		err := rp.rewind()
+		if err != nil {
+			return err
+		}
+	}
+	for rp.game.Frame < frame && rp.Step() {
+	}
+	return nil
+}
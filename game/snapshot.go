@@ -0,0 +1,223 @@
+package game
+
+import (
+	"github.com/runningwild/jota/stats"
+	"github.com/runningwild/linear"
+	"reflect"
+	"sync"
+)
+
+// Scripts run in their own goroutines and look at the game constantly.  If
+// they had to pause the engine for every look they would stall the game many
+// times a frame, and they would see a different frame from one look to the
+// next.  Instead the host publishes a Snapshot at the end of every frame, a
+// copy of everything that scripts can look at, that is never changed after it
+// is published and so can be read without any locking.
+
+// Snapshot is a copy of the parts of a game that scripts can look at, as they
+// were at the end of a frame.  Nothing in it may be modified.
+type Snapshot struct {
+	Frame int
+
+	Ents map[Gid]*EntSnapshot
+
+	// Every ent and every control point, in the order the game goes through
+	// them.
+	Order         []Gid
+	ControlPoints []Gid
+
+	walls   []linear.Seg2
+	pathing *PathingData
+	mana    *ManaSource
+}
+
+type EntSnapshot struct {
+	Gid   Gid
+	Type  EntType
+	Side  int
+	Pos   linear.Vec2
+	Vel   linear.Vec2
+	Angle float64
+
+	// Current stats, including any changes made by conditions.
+	Health     float64
+	MaxHealth  float64
+	Mass       float64
+	MaxTurn    float64
+	MaxAcc     float64
+	MaxRate    float64
+	Cloaking   float64
+	Size       float64
+	Vision     float64
+	Armor      stats.PerKind
+	Resistance stats.PerKind
+
+	// Ordered by their ids.
+	Processes []ProcessSnapshot
+
+	// In the same order as the ent's abilities.
+	Abilities []AbilitySnapshot
+}
+
+type ProcessSnapshot struct {
+	// Name of the process's type.
+	Name string
+
+	// Damage done by the process every frame.
+	Damage stats.Damage
+}
+
+type AbilitySnapshot struct {
+	// Name the ability was made with, only known for players.
+	Name string
+
+	IsActive bool
+}
+
+// The most recently published snapshot.
+type snapshotData struct {
+	current *Snapshot
+	sync.Mutex
+}
+
+// Snapshot returns the snapshot published at the end of the most recent
+// frame, or nil if there isn't one yet.  Only the engine that runs the Ais
+// publishes snapshots.
+func (g *Game) Snapshot() *Snapshot {
+	g.local.snapshot.Lock()
+	defer g.local.snapshot.Unlock()
+	return g.local.snapshot.current
+}
+
+// publishSnapshot makes and publishes a snapshot of the current frame.  Making
+// one copies a fair amount of the game, so nothing is published while there
+// aren't any Ais to look at it.
+func (g *Game) publishSnapshot() {
+	if !g.runsAis() || !g.hasAis() {
+		return
+	}
+	s := &Snapshot{
+		Frame:   g.Frame,
+		Ents:    make(map[Gid]*EntSnapshot, len(g.local.temp.AllEnts)),
+		walls:   g.local.temp.AllWalls,
+		pathing: g.local.pathingData,
+		mana:    g.Level.ManaSource.copyNodes(),
+	}
+	for _, ent := range g.local.temp.AllEnts {
+		if ent.Dead() {
+			continue
+		}
+		s.Ents[ent.Id()] = g.snapshotEnt(ent)
+		s.Order = append(s.Order, ent.Id())
+		if ent.Type() == EntTypeControlPoint {
+			s.ControlPoints = append(s.ControlPoints, ent.Id())
+		}
+	}
+	g.local.snapshot.Lock()
+	g.local.snapshot.current = s
+	g.local.snapshot.Unlock()
+}
+
+// hasAis returns true if any ent has an Ai bound to it.
+func (g *Game) hasAis() bool {
+	for _, ent := range g.local.temp.AllEnts {
+		if b, ok := baseEntOf(ent); ok && b.ai != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Game) snapshotEnt(ent Ent) *EntSnapshot {
+	st := ent.Stats()
+	es := &EntSnapshot{
+		Gid:        ent.Id(),
+		Type:       ent.Type(),
+		Side:       ent.Side(),
+		Pos:        ent.Pos(),
+		Vel:        ent.Vel(),
+		Angle:      ent.Angle(),
+		Health:     st.HealthCur(),
+		MaxHealth:  st.HealthMax(),
+		Mass:       st.Mass(),
+		MaxTurn:    st.MaxTurn(),
+		MaxAcc:     st.MaxAcc(),
+		MaxRate:    st.MaxRate(),
+		Cloaking:   st.Cloaking(),
+		Size:       st.Size(),
+		Vision:     st.Vision(),
+		Armor:      snapshotPerKind(st.Armor),
+		Resistance: snapshotPerKind(st.Resistance),
+	}
+	for _, proc := range EntProcesses(ent) {
+		es.Processes = append(es.Processes, ProcessSnapshot{
+			Name:   reflect.Indirect(reflect.ValueOf(proc)).Type().Name(),
+			Damage: proc.CauseDamage(),
+		})
+	}
+	var names []string
+	if player, ok := ent.(*PlayerEnt); ok && player.Champ < len(g.Champs) && g.Champs[player.Champ].ChampionDef != nil {
+		for _, ab := range g.Champs[player.Champ].Abilities {
+			names = append(names, ab.Name)
+		}
+	}
+	for i, ab := range ent.Abilities() {
+		as := AbilitySnapshot{IsActive: ab.IsActive()}
+		if i < len(names) {
+			as.Name = names[i]
+		}
+		es.Abilities = append(es.Abilities, as)
+	}
+	return es
+}
+
+func snapshotPerKind(get func(stats.DamageKind) float64) stats.PerKind {
+	var p stats.PerKind
+	for _, kind := range []stats.DamageKind{stats.DamageFire, stats.DamageAcid, stats.DamageCrushing} {
+		p.Set(kind, get(kind))
+	}
+	return p
+}
+
+// ExistsLos returns true if no walls are between a and b, just like
+// Game.ExistsLos.
+func (s *Snapshot) ExistsLos(a, b linear.Vec2) bool {
+	los := linear.Seg2{a, b}
+	for _, wall := range s.walls {
+		if wall.DoesIsectOrTouch(los) {
+			return false
+		}
+	}
+	return true
+}
+
+// EntsInRange returns every ent within dist of pos, in the order the game goes
+// through them.
+func (s *Snapshot) EntsInRange(pos linear.Vec2, dist float64) []*EntSnapshot {
+	var ents []*EntSnapshot
+	for _, gid := range s.Order {
+		ent := s.Ents[gid]
+		if ent.Pos.Sub(pos).Mag2() <= dist*dist {
+			ents = append(ents, ent)
+		}
+	}
+	return ents
+}
+
+// PathDir returns the direction to go from src to get to dst.
+func (s *Snapshot) PathDir(src, dst linear.Vec2) linear.Vec2 {
+	if s.pathing == nil {
+		return dst.Sub(src).Norm()
+	}
+	return s.pathing.Dir(src, dst)
+}
+
+// ManaNear returns the total mana of each color within dist of pos.
+func (s *Snapshot) ManaNear(pos linear.Vec2, dist float64) Mana {
+	return s.mana.ManaNear(pos, dist)
+}
+
+// MaxDrainDistance returns how close an ent must be to mana to drain it.
+func (s *Snapshot) MaxDrainDistance() float64 {
+	return s.mana.MaxDrainDistance()
+}
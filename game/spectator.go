@@ -0,0 +1,157 @@
+package game
+
+import (
+	"encoding/gob"
+	"github.com/runningwild/jota/base"
+	"github.com/runningwild/linear"
+)
+
+// Engines without any players can watch the game.  That includes engines that
+// chose to spectate during setup as well as engines that joined a game that
+// was already running and didn't rejoin as anyone.  A spectator either follows
+// a player, seeing exactly what that player sees, or moves a free camera
+// around the room.  The free camera ignores line of sight, and while following
+// a player the spectator can choose to ignore it too, so that casters can see
+// what both sides are doing.
+
+// Most and least of the room the free camera can show, as a fraction of the
+// room's size.
+const (
+	maxFreeCamZoom = 1.5
+	minFreeCamZoom = 0.2
+)
+
+// SetupSpectate makes an engine, and any other players on it, spectate rather
+// than play, or the opposite.
+type SetupSpectate struct {
+	EngineId int64
+	Spectate bool
+}
+
+func init() {
+	gob.Register(SetupSpectate{})
+}
+
+func (s SetupSpectate) Apply(_g interface{}) {
+	g := _g.(*Game)
+	g.recordEvent(s)
+	if g.Setup == nil || s.Spectate == g.Setup.isSpectator(s.EngineId) {
+		return
+	}
+	if s.Spectate {
+		g.Setup.Spectators = append(g.Setup.Spectators, s.EngineId)
+	} else {
+		var spectators []int64
+		for _, id := range g.Setup.Spectators {
+			if id != s.EngineId {
+				spectators = append(spectators, id)
+			}
+		}
+		g.Setup.Spectators = spectators
+	}
+	g.Setup.updatePlayerIds()
+}
+
+func (s *SetupData) isSpectator(engineId int64) bool {
+	for _, id := range s.Spectators {
+		if id == engineId {
+			return true
+		}
+	}
+	return false
+}
+
+type spectatorData struct {
+	// Gid of the player being followed, or empty when using the free camera.
+	Following Gid
+
+	// If true line of sight is ignored while following a player.
+	FullVision bool
+
+	// Where the free camera is looking, and how much of the room it shows as a
+	// fraction of the room's size.
+	FreeCamMid  linear.Vec2
+	FreeCamZoom float64
+}
+
+// IsSpectating returns true if the game has started and this engine is
+// watching it rather than playing in it.
+func (g *Game) IsSpectating() bool {
+	return g.Setup == nil && g.local.Engine != nil && len(g.local.Players) == 0
+}
+
+// spectatorTargets returns the Gids of every player that can be followed,
+// ordered by their ids.
+func (g *Game) spectatorTargets() []Gid {
+	var gids []Gid
+	base.DoOrdered(g.Engines, func(a, b int64) bool { return a < b }, func(id int64, data *PlayerData) {
+		gids = append(gids, data.PlayerGid)
+	})
+	return gids
+}
+
+// spectateFollow follows the player delta places after the one currently being
+// followed, wrapping around at either end.  If the free camera is in use the
+// first or last player is followed.
+func (g *Game) spectateFollow(delta int) {
+	targets := g.spectatorTargets()
+	if len(targets) == 0 {
+		return
+	}
+	index := -1
+	for i, gid := range targets {
+		if gid == g.local.spectator.Following {
+			index = i
+		}
+	}
+	switch {
+	case index == -1 && delta > 0:
+		index = 0
+	case index == -1:
+		index = len(targets) - 1
+	default:
+		index = ((index+delta)%len(targets) + len(targets)) % len(targets)
+	}
+	g.setSpectatorFollowing(targets[index])
+}
+
+// spectateFreeCam switches to the free camera, starting wherever the followed
+// player is.
+func (g *Game) spectateFreeCam() {
+	if ent := g.Ents[g.local.spectator.Following]; ent != nil {
+		g.local.spectator.FreeCamMid = ent.Pos()
+	}
+	g.setSpectatorFollowing("")
+}
+
+// setSpectatorFollowing follows gid, or uses the free camera if gid is empty.
+// The local player is pointed at the followed player so that the camera, line
+// of sight and side colors all work just like they do for that player.
+func (g *Game) setSpectatorFollowing(gid Gid) {
+	g.local.spectator.Following = gid
+	g.local.Gid = gid
+	g.local.Side = g.GidToSide(gid)
+}
+
+// moveFreeCam moves the free camera by delta, as a fraction of what it
+// currently shows, and zooms it by zoom.
+func (g *Game) moveFreeCam(delta linear.Vec2, zoom float64) {
+	spec := &g.local.spectator
+	room := linear.Vec2{float64(g.Level.Room.Dx), float64(g.Level.Room.Dy)}
+	if spec.FreeCamZoom == 0 {
+		spec.FreeCamZoom = 1
+		if spec.FreeCamMid == (linear.Vec2{}) {
+			spec.FreeCamMid = room.Scale(0.5)
+		}
+	}
+	spec.FreeCamZoom *= zoom
+	if spec.FreeCamZoom < minFreeCamZoom {
+		spec.FreeCamZoom = minFreeCamZoom
+	}
+	if spec.FreeCamZoom > maxFreeCamZoom {
+		spec.FreeCamZoom = maxFreeCamZoom
+	}
+	spec.FreeCamMid = spec.FreeCamMid.Add((linear.Vec2{delta.X * room.X, delta.Y * room.Y}).Scale(spec.FreeCamZoom))
+	spec.FreeCamMid.X = clamp(spec.FreeCamMid.X, 0, room.X)
+	spec.FreeCamMid.Y = clamp(spec.FreeCamMid.Y, 0, room.Y)
+}
@@ -0,0 +1,85 @@
+package gui
+
+import (
+	"github.com/runningwild/glop/gin"
+	"github.com/runningwild/glop/gui"
+	"github.com/runningwild/jota/base"
+)
+
+// A TextEntry is a labeled line of text that can be typed into.  In a
+// ThunderSubMenu it only gets keyboard events while it is selected.
+type TextEntry struct {
+	Name string
+	Text string
+	Size int
+
+	// If set only characters that are accepted by Allow can be typed.
+	Allow func(c byte) bool
+
+	// If positive the text can't be made longer than this.
+	MaxLength int
+
+	Hover bool
+	Last  Region
+}
+
+func (t *TextEntry) Think(gui *Gui) {
+	x, y := gui.sys.GetCursorPos()
+	t.Hover = x >= t.Last.X && x < t.Last.X+t.Last.Dx &&
+		y >= t.Last.Y && y < t.Last.Y+t.Last.Dy
+}
+
+func (t *TextEntry) Respond(eventGroup gin.EventGroup) {
+	if eventGroup.Events[0].Key.Id().Device.Type == gin.DeviceTypeMouse {
+		return
+	}
+	for _, event := range eventGroup.Events {
+		if event.Type != gin.Press {
+			continue
+		}
+		index := event.Key.Id().Index
+		if index == gin.Backspace {
+			if len(t.Text) > 0 {
+				t.Text = t.Text[0 : len(t.Text)-1]
+			}
+			continue
+		}
+		if index < 32 || index > 126 {
+			continue
+		}
+		c := byte(index)
+		if t.Allow != nil && !t.Allow(c) {
+			continue
+		}
+		if t.MaxLength > 0 && len(t.Text) >= t.MaxLength {
+			continue
+		}
+		t.Text += string(c)
+	}
+}
+
+func (t *TextEntry) label() string {
+	return t.Name + ": " + t.Text
+}
+
+func (t *TextEntry) Draw(region Region, style StyleStack) {
+	t.Last = region
+	selected, ok := style.Get("selected").(bool)
+	var xOffset float64
+	renderText := t.label()
+	if t.Hover || (ok && selected) {
+		gui.SetFontColor(0, 0, 0, 1)
+		renderText = ">" + renderText + "_"
+	} else {
+		gui.SetFontColor(0, 0, 0, 0.7)
+		xOffset = base.GetDictionary("luxisr").StringWidth(">", float64(t.Size))
+	}
+	base.GetDictionary("luxisr").RenderString(renderText, xOffset+float64(region.X), float64(region.Y), 0, float64(t.Size), gui.Left)
+}
+
+func (t *TextEntry) RequestedDims() Dims {
+	dict := base.GetDictionary("luxisr")
+	mark := dict.StringWidth(">", float64(t.Size))
+	text := dict.StringWidth(t.label()+"_", float64(t.Size))
+	return Dims{int(mark + text), t.Size}
+}
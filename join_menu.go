@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"github.com/runningwild/glop/gin"
+	"github.com/runningwild/glop/render"
+	"github.com/runningwild/jota/base"
+	g2 "github.com/runningwild/jota/gui"
+	"github.com/runningwild/jota/lan"
+	"strconv"
+	"time"
+)
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAddrChar(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || c == '.' || c == '-' || c == ':'
+}
+
+// lanSubMenu makes a sub menu with a button for each game in games that calls
+// join with that game.
+func lanSubMenu(games []lan.Game, triggers map[gin.KeyId]struct{}, join func(lan.Game), back func()) *g2.ThunderSubMenu {
+	var options []g2.Widget
+	for _, game := range games {
+		game := game
+		name := fmt.Sprintf("%s (%s) %d", game.Name, game.Room, game.Players)
+		if game.MaxPlayers > 0 {
+			name += fmt.Sprintf("/%d", game.MaxPlayers)
+		}
+		if game.Started {
+			name += " started"
+		}
+		options = append(options, &g2.Button{Name: name, Size: 30, Triggers: triggers, Callback: func() { join(game) }})
+	}
+	if len(games) == 0 {
+		options = append(options, &g2.Button{Name: "Searching...", Size: 30})
+	}
+	options = append(options, &g2.Button{Name: "Back", Size: 50, Triggers: triggers, Callback: back})
+	return g2.MakeThunderSubMenu(options)
+}
+
+// sameGames returns true if a and b list the same games, ignoring when they
+// were last announced.
+func sameGames(a, b []lan.Game) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Announcement != b[i].Announcement || a[i].Addr != b[i].Addr {
+			return false
+		}
+	}
+	return true
+}
+
+// joinMenu lets the player pick the address and port of the host to join,
+// either by typing them in or from the games announced on the LAN, starting
+// from conn.  Returns false if the player quit instead of joining.
+// The chosen connection is saved to the store.
+func joinMenu(conn connection) (connection, bool) {
+	addr := &g2.TextEntry{Name: "Address", Text: conn.Addr, Size: 30, Allow: isAddrChar, MaxLength: 64}
+	port := &g2.TextEntry{Name: "Port", Text: strconv.Itoa(conn.Port), Size: 30, Allow: isDigit, MaxLength: 5}
+	var joined, quit bool
+	var menu g2.ThunderMenu
+	menu.Subs = make(map[string]*g2.ThunderSubMenu)
+	triggers := map[gin.KeyId]struct{}{
+		gin.In().GetKeyFlat(gin.Return, gin.DeviceTypeKeyboard, gin.DeviceIndexAny).Id():              struct{}{},
+		gin.In().GetKeyFlat(gin.ControllerButton0, gin.DeviceTypeController, gin.DeviceIndexAny).Id(): struct{}{},
+	}
+	menu.Subs[""] = g2.MakeThunderSubMenu(
+		[]g2.Widget{
+			&g2.Button{Name: "Join LAN game", Size: 50, Triggers: triggers, Callback: func() { menu.Push("lan") }},
+			&g2.Button{Name: "Join by address", Size: 50, Triggers: triggers, Callback: func() { menu.Push("join") }},
+			&g2.Button{Name: "Quit", Size: 50, Triggers: triggers, Callback: func() { quit = true }},
+		})
+	menu.Subs["join"] = g2.MakeThunderSubMenu(
+		[]g2.Widget{
+			addr,
+			port,
+			&g2.Button{Name: "Connect", Size: 50, Triggers: triggers, Callback: func() { joined = true }},
+			&g2.Button{Name: "Back", Size: 50, Triggers: triggers, Callback: func() { menu.Pop() }},
+		})
+	joinLan := func(game lan.Game) {
+		addr.Text = game.Addr
+		port.Text = strconv.Itoa(game.Port)
+		joined = true
+	}
+	var games []lan.Game
+	menu.Subs["lan"] = lanSubMenu(games, triggers, joinLan, menu.Pop)
+	browser, err := lan.Browse(*lanPortFlag)
+	if err != nil {
+		base.Warn().Printf("Unable to look for LAN games: %v", err)
+	} else {
+		defer browser.Close()
+	}
+	menu.Start(600)
+
+	ui := g2.Make(0, 0, wdx, wdy)
+	defer ui.StopEventListening()
+	ui.AddChild(&menu, g2.AnchorDeadCenter)
+	ticker := time.Tick(time.Millisecond * 17)
+	for !quit {
+		<-ticker
+		if gin.In().GetKey(gin.AnyEscape).FramePressCount() != 0 {
+			return conn, false
+		}
+		if browser != nil {
+			current := browser.Games()
+			if !sameGames(current, games) {
+				games = current
+				menu.Subs["lan"] = lanSubMenu(games, triggers, joinLan, menu.Pop)
+			}
+		}
+		sys.Think()
+		ui.Think()
+		render.Queue(func() {
+			ui.Draw()
+		})
+		render.Queue(func() {
+			sys.SwapBuffers()
+		})
+		render.Purge()
+		if !joined {
+			continue
+		}
+		joined = false
+		p, err := strconv.Atoi(port.Text)
+		if addr.Text == "" || err != nil || p <= 0 || p > 65535 {
+			base.Warn().Printf("Invalid address: %q, port: %q", addr.Text, port.Text)
+			continue
+		}
+		conn.Addr = addr.Text
+		conn.Port = p
+		conn.save()
+		return conn, true
+	}
+	return conn, false
+}
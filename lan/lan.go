@@ -0,0 +1,246 @@
+// Package lan lets hosts announce their games on the local network and lets
+// clients find them.  Hosts periodically send a small json Announcement over
+// udp, normally to the broadcast address, and a Browser listens for them.
+//
+// To try it on a single machine announce to the loopback address instead, for
+// example by running a host with -lan-target 127.0.0.1:20008.
+package lan
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/runningwild/cgf"
+	"github.com/runningwild/jota/base"
+	"github.com/runningwild/jota/game"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Version of the announcement protocol.  Announcements with a different
+// version are ignored by browsers.
+const Version = 1
+
+// Port that browsers listen on by default.
+const Port = 20008
+
+// DefaultTarget is where announcements are sent by default.
+var DefaultTarget = fmt.Sprintf("255.255.255.255:%d", Port)
+
+const (
+	announceInterval = time.Second
+
+	// Games that haven't been announced for this long are dropped by browsers.
+	expireAfter = 3 * announceInterval
+
+	maxPacketSize = 1024
+)
+
+// Announcement is what a host sends to describe its game.
+type Announcement struct {
+	Version int
+
+	// Name of the game and the port it is hosted on.
+	Name string
+	Port int
+
+	// Name of the room that will be played, or is being played.
+	Room string
+
+	// Number of players that have joined, and the most that may join.  If
+	// MaxPlayers is zero there is no limit.
+	Players    int
+	MaxPlayers int
+
+	// True once the game has left setup.
+	Started bool
+}
+
+// A Game is an Announcement as received by a Browser.
+type Game struct {
+	Announcement
+
+	// Address of the host that sent the announcement.
+	Addr string
+
+	last time.Time
+}
+
+// Announcer sends an announcement every second until it is closed.
+type Announcer struct {
+	conn *net.UDPConn
+	info func() Announcement
+	done chan struct{}
+}
+
+// Announce starts announcing to target, which is normally DefaultTarget.  info
+// is called before each announcement to get its contents, Version is filled in
+// by the Announcer.
+func Announce(target string, info func() Announcement) (*Announcer, error) {
+	addr, err := net.ResolveUDPAddr("udp4", target)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	a := &Announcer{conn: conn, info: info, done: make(chan struct{})}
+	go a.routine()
+	return a, nil
+}
+
+func (a *Announcer) routine() {
+	ticker := time.NewTicker(announceInterval)
+	defer ticker.Stop()
+	for {
+		a.announce()
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Announcer) announce() {
+	ann := a.info()
+	ann.Version = Version
+	data, err := json.Marshal(ann)
+	if err != nil {
+		base.Error().Printf("Unable to encode announcement: %v", err)
+		return
+	}
+	_, err = a.conn.Write(data)
+	if err != nil {
+		base.Warn().Printf("Unable to send announcement: %v", err)
+	}
+}
+
+// Close stops announcing.
+func (a *Announcer) Close() {
+	close(a.done)
+	a.conn.Close()
+}
+
+// AnnounceEngine announces the game being hosted by engine, which must have
+// been made by cgf.NewHostEngine with a *game.Game, as name on port.
+func AnnounceEngine(target string, engine *cgf.Engine, name string, port int) (*Announcer, error) {
+	// MaxPlayers isn't kept once setup is complete, so the last value seen
+	// during setup is announced.
+	var maxPlayers int
+	return Announce(target, func() Announcement {
+		engine.Pause()
+		defer engine.Unpause()
+		g := engine.GetState().(*game.Game)
+		ann := Announcement{Name: name, Port: port}
+		if g.Setup != nil {
+			ann.Room = g.Setup.Room
+			maxPlayers = g.Setup.MaxPlayers
+			ann.Players = countPlayers(g.Setup.EngineIds)
+		} else {
+			if g.Level != nil {
+				ann.Room = g.Level.Name
+			}
+			var ids []int64
+			for id := range g.Engines {
+				ids = append(ids, id)
+			}
+			ann.Players = countPlayers(ids)
+			ann.Started = true
+		}
+		ann.MaxPlayers = maxPlayers
+		return ann
+	})
+}
+
+// countPlayers returns how many of ids are players rather than bots, which
+// have negative ids.
+func countPlayers(ids []int64) int {
+	count := 0
+	for _, id := range ids {
+		if id >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// Browser keeps track of the games being announced on a port.
+type Browser struct {
+	conn  *net.UDPConn
+	games map[string]Game
+	sync.Mutex
+}
+
+// Browse starts listening for announcements on port, which is normally Port.
+func Browse(port int) (*Browser, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+	b := &Browser{conn: conn, games: make(map[string]Game)}
+	go b.routine()
+	return b, nil
+}
+
+func (b *Browser) routine() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			// The connection was closed.
+			return
+		}
+		var game Game
+		err = json.Unmarshal(buf[0:n], &game.Announcement)
+		if err != nil {
+			base.Warn().Printf("Bad announcement from %v: %v", from, err)
+			continue
+		}
+		if game.Version != Version {
+			continue
+		}
+		game.Addr = from.IP.String()
+		game.last = time.Now()
+		b.Lock()
+		b.games[fmt.Sprintf("%s:%d", game.Addr, game.Port)] = game
+		b.Unlock()
+	}
+}
+
+type gameSlice []Game
+
+func (g gameSlice) Len() int      { return len(g) }
+func (g gameSlice) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
+func (g gameSlice) Less(i, j int) bool {
+	if g[i].Name != g[j].Name {
+		return g[i].Name < g[j].Name
+	}
+	if g[i].Addr != g[j].Addr {
+		return g[i].Addr < g[j].Addr
+	}
+	return g[i].Port < g[j].Port
+}
+
+// Games returns the games that have been announced recently, sorted by name.
+func (b *Browser) Games() []Game {
+	b.Lock()
+	defer b.Unlock()
+	var games []Game
+	for key, game := range b.games {
+		if time.Since(game.last) > expireAfter {
+			delete(b.games, key)
+			continue
+		}
+		games = append(games, game)
+	}
+	sort.Sort(gameSlice(games))
+	return games
+}
+
+// Close stops listening for announcements.
+func (b *Browser) Close() {
+	b.conn.Close()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	gl "github.com/chsc/gogl/gl21"
 	"github.com/runningwild/glop/gin"
@@ -18,6 +19,7 @@ import (
 	"github.com/runningwild/jota/base"
 	_ "github.com/runningwild/jota/effects"
 	"github.com/runningwild/jota/game"
+	"github.com/runningwild/jota/lan"
 	_ "github.com/runningwild/jota/script"
 	_ "image/jpeg"
 	_ "image/png"
@@ -33,8 +35,15 @@ var (
 	ui       *gui.Gui
 	wdx, wdy int
 	key_map  base.KeyMap
+
+	recordPath = flag.String("record", "", "If set, a replay of the game will be recorded to this file.")
+
+	deterministicAi = flag.Bool("deterministic-ai", false, "If set when hosting, Ais are run with the game so that a match plays out the same every time with the same seed.")
 )
 
+// How long to show that this engine was kicked before disconnecting.
+const kickedDisconnectDelay = 3 * time.Second
+
 func init() {
 	runtime.LockOSThread()
 	sys = system.Make(gos.GetSystemInterface())
@@ -51,7 +60,7 @@ func init() {
 	base.SetDefaultKeyMap(key_map)
 }
 
-func debugHookup(version string) *cgf.Engine {
+func debugHookup(version string, conn connection) *cgf.Engine {
 	var err error
 	for false && len(sys.GetActiveDevices()[gin.DeviceTypeController]) < 2 {
 		time.Sleep(time.Millisecond * 100)
@@ -60,25 +69,34 @@ func debugHookup(version string) *cgf.Engine {
 
 	var engine *cgf.Engine
 	if version != "host" {
-		engine, err = cgf.NewClientEngine(17, "thunderingvictory.dyndns.org", 20007, base.EmailCrashReport, base.Log())
+		game.UseRejoinKey(conn.Addr, conn.Port)
+		conn = simulateNetwork(conn)
+		engine, err = cgf.NewClientEngine(game.FrameMs, conn.Addr, conn.Port, base.EmailCrashReport, base.Log())
 		if err != nil {
-			base.Log().Printf("Unable to connect: %v", err)
+			base.Log().Printf("Unable to connect to %s:%d: %v", conn.Addr, conn.Port, err)
 			base.Error().Fatalf("%v", err.Error())
 		}
 	} else {
 		sys.Think()
 		g := game.MakeGame()
+		g.Setup.DeterministicAi = *deterministicAi
 		if version == "host" {
-			engine, err = cgf.NewHostEngine(g, 17, "", 20007, base.EmailCrashReport, base.Log())
+			engine, err = cgf.NewHostEngine(g, game.FrameMs, "", conn.Port, base.EmailCrashReport, base.Log())
 			if err != nil {
 				panic(err)
 			}
-			err = cgf.Host(20007, "thunderball")
+			err = cgf.Host(conn.Port, conn.Name)
 			if err != nil {
 				panic(err)
 			}
+			if *lanTargetFlag != "" {
+				lanAnnouncer, err = lan.AnnounceEngine(*lanTargetFlag, engine, conn.Name, conn.Port)
+				if err != nil {
+					base.Warn().Printf("Unable to announce game on the LAN: %v", err)
+				}
+			}
 		} else {
-			engine, err = cgf.NewLocalEngine(g, 17, base.EmailCrashReport, base.Log())
+			engine, err = cgf.NewLocalEngine(g, game.FrameMs, base.EmailCrashReport, base.Log())
 		}
 		if err != nil {
 			base.Error().Fatalf("%v", err.Error())
@@ -95,6 +113,30 @@ func debugHookup(version string) *cgf.Engine {
 
 func mainLoop(engine *cgf.Engine, mode string) {
 	defer engine.Kill()
+	defer func() {
+		engine.Pause()
+		g := engine.GetState().(*game.Game)
+		err := g.StopRecording()
+		delay := g.InputDelay()
+		statuses := g.AiStatuses()
+		engine.Unpause()
+		if err != nil {
+			base.Error().Printf("Unable to finish recording: %v", err)
+		}
+		base.Log().Printf("Input delay: %v", delay)
+		base.DoOrdered(statuses, func(a, b game.Gid) bool { return a < b }, func(gid game.Gid, status game.AiStatus) {
+			if status.Failures > 0 {
+				base.Warn().Printf("Ai %v: %v", gid, status)
+			}
+		})
+		if simProxy != nil {
+			base.Log().Printf("Network simulator: %v", simProxy.Stats())
+			simProxy.Close()
+		}
+		if lanAnnouncer != nil {
+			lanAnnouncer.Close()
+		}
+	}()
 	var profile_output *os.File
 	var contention_output *os.File
 	var num_mem_profiles int
@@ -111,11 +153,24 @@ func mainLoop(engine *cgf.Engine, mode string) {
 	// side1Key := gin.In().GetKeyFlat(side1Index, gin.DeviceTypeAny, gin.DeviceIndexAny)
 	// side2Key := gin.In().GetKeyFlat(side2Index, gin.DeviceTypeAny, gin.DeviceIndexAny)
 	defer ui.StopEventListening()
-	for {
+	var kickedAt time.Time
+	for frame := 0; ; frame++ {
 		<-ticker
 		if gin.In().GetKey(gin.AnyEscape).FramePressCount() != 0 {
 			return
 		}
+		if kickedAt.IsZero() && frame%60 == 0 {
+			engine.Pause()
+			kicked := engine.GetState().(*game.Game).Kicked()
+			engine.Unpause()
+			if kicked {
+				base.Log().Printf("Kicked from the game, disconnecting in %v", kickedDisconnectDelay)
+				kickedAt = time.Now()
+			}
+		}
+		if !kickedAt.IsZero() && time.Since(kickedAt) > kickedDisconnectDelay {
+			return
+		}
 		start := time.Now()
 		sys.Think()
 		start = time.Now()
@@ -182,6 +237,7 @@ func mainLoop(engine *cgf.Engine, mode string) {
 
 func main() {
 	defer base.StackCatcher()
+	flag.Parse()
 	sys.Startup()
 	err := gl.Init()
 	if err != nil {
@@ -200,7 +256,23 @@ func main() {
 	base.LoadAllDictionaries()
 
 	if Version() != "standard" {
-		engine := debugHookup(Version())
+		conn, explicit := loadConnection()
+		if Version() != "host" && !explicit {
+			var ok bool
+			conn, ok = joinMenu(conn)
+			if !ok {
+				return
+			}
+		}
+		engine := debugHookup(Version(), conn)
+		if *recordPath != "" {
+			engine.Pause()
+			err := engine.GetState().(*game.Game).StartRecording(*recordPath)
+			engine.Unpause()
+			if err != nil {
+				base.Error().Printf("Unable to record to '%s': %v", *recordPath, err)
+			}
+		}
 		mainLoop(engine, "standard")
 	} else {
 		// TODO: Reimplement standard hookup
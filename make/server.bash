@@ -0,0 +1,7 @@
+set -e
+# Builds the dedicated server, which doesn't need a display or any of the
+# graphics libraries.  Run from jota root directory.
+cd $GOPATH/src/github.com/runningwild/jota
+
+go build --tags nographics -o bin/jota-server ./server
+echo "Built bin/jota-server, run it with -data pointing at the data directory."
@@ -0,0 +1,335 @@
+// Package netsim is a proxy that makes the connection between two engines
+// behave like a worse one, so that games can be tried with latency, jitter,
+// reordering and packet loss without a bad network.  Everything sent through
+// the proxy, over tcp or udp, is forwarded to a target after a delay.
+//
+// Tcp never loses or reorders data, it just retransmits it, so over tcp lost
+// packets are delivered late instead of being dropped, and everything is
+// delivered in order.  Over udp lost packets are dropped and reordered packets
+// are held back behind later ones.
+//
+// To put the proxy between two engines in the same process, make a host
+// engine on one port, start a proxy with that port as the target, and connect
+// a client engine to the proxy's port:
+//
+//	host, _ := cgf.NewHostEngine(g, game.FrameMs, "", 20007, nil, nil)
+//	proxy, _ := netsim.Listen(netsim.Config{Latency: 75 * time.Millisecond}, 0, "127.0.0.1:20007")
+//	client, _ := cgf.NewClientEngine(game.FrameMs, "127.0.0.1", proxy.Port(), nil, nil)
+package netsim
+
+import (
+	"fmt"
+	"github.com/runningwild/jota/base"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Delay added to a lost tcp packet, on top of the round trip it takes to
+	// find out that it was lost.
+	retransmitDelay = 200 * time.Millisecond
+
+	// Udp clients that haven't sent anything for this long are forgotten.
+	udpSessionTimeout = time.Minute
+
+	maxPacketSize = 64 * 1024
+)
+
+// Config describes how much worse the proxy makes the connection.  Each
+// direction is affected separately, so the round trip latency is twice
+// Latency.
+type Config struct {
+	// Delay added to everything.
+	Latency time.Duration
+
+	// Most extra delay, chosen at random for each packet.
+	Jitter time.Duration
+
+	// From 0 to 1, the fraction of packets that are lost.
+	Loss float64
+
+	// From 0 to 1, the fraction of udp packets that are delivered after the
+	// packet sent after them.
+	Reorder float64
+
+	// Seed for the random numbers, so that runs can be repeated.
+	Seed int64
+}
+
+// Enabled returns true if the config makes the connection any worse.
+func (c Config) Enabled() bool {
+	return c.Latency > 0 || c.Jitter > 0 || c.Loss > 0 || c.Reorder > 0
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("latency %v, jitter %v, loss %.0f%%, reorder %.0f%%", c.Latency, c.Jitter, c.Loss*100, c.Reorder*100)
+}
+
+// Stats counts what the proxy has done so far.
+type Stats struct {
+	// Packets forwarded, tcp reads count as packets.
+	Packets int
+
+	// Packets lost, over tcp these were delayed instead.
+	Lost int
+
+	// Udp packets delivered out of order.
+	Reordered int
+
+	// Total delay added to all of the packets that were forwarded.
+	Delay time.Duration
+}
+
+func (s Stats) String() string {
+	if s.Packets == 0 {
+		return "no packets"
+	}
+	average := s.Delay / time.Duration(s.Packets)
+	return fmt.Sprintf("%d packets, %d lost, %d reordered, %v average delay", s.Packets, s.Lost, s.Reordered, average)
+}
+
+// Proxy forwards connections made to it to its target.
+type Proxy struct {
+	config Config
+	target string
+
+	listener *net.TCPListener
+	udp      *net.UDPConn
+
+	// Udp connections to the target, by the address of the client that they
+	// forward for.
+	sessions map[string]*udpSession
+
+	rng   *rand.Rand
+	stats Stats
+	sync.Mutex
+}
+
+type udpSession struct {
+	conn *net.UDPConn
+	last time.Time
+}
+
+// Listen starts a proxy on port, or on any free port if port is 0, that
+// forwards to target, as host:port, according to config.
+func Listen(config Config, port int, target string) (*Proxy, error) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+	port = listener.Addr().(*net.TCPAddr).Port
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	p := &Proxy{
+		config:   config,
+		target:   target,
+		listener: listener,
+		udp:      udp,
+		sessions: make(map[string]*udpSession),
+		rng:      rand.New(rand.NewSource(config.Seed)),
+	}
+	base.Log().Printf("Simulating %v between port %d and %s", config, port, target)
+	go p.acceptRoutine()
+	go p.udpRoutine()
+	return p, nil
+}
+
+// Port returns the port that the proxy is listening on.
+func (p *Proxy) Port() int {
+	return p.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Stats returns what the proxy has done so far.
+func (p *Proxy) Stats() Stats {
+	p.Lock()
+	defer p.Unlock()
+	return p.stats
+}
+
+// Close stops accepting connections.  Connections that are already open are
+// closed when either end closes them.
+func (p *Proxy) Close() {
+	p.listener.Close()
+	p.udp.Close()
+	p.Lock()
+	defer p.Unlock()
+	for addr, session := range p.sessions {
+		session.conn.Close()
+		delete(p.sessions, addr)
+	}
+}
+
+// delay decides what happens to the next packet.  lost is true if the packet
+// should be dropped, or retransmitted over tcp, and reordered is true if it
+// should be held back behind the next packet.
+func (p *Proxy) delay(tcp bool) (delay time.Duration, lost, reordered bool) {
+	p.Lock()
+	defer p.Unlock()
+	delay = p.config.Latency
+	if p.config.Jitter > 0 {
+		delay += time.Duration(p.rng.Int63n(int64(p.config.Jitter)))
+	}
+	lost = p.rng.Float64() < p.config.Loss
+	reordered = !tcp && !lost && p.rng.Float64() < p.config.Reorder
+	p.stats.Packets++
+	switch {
+	case lost && tcp:
+		delay += 2*p.config.Latency + retransmitDelay
+		p.stats.Lost++
+	case lost:
+		p.stats.Lost++
+	case reordered:
+		// Late enough that the next packet is almost certainly sent and
+		// delivered first.
+		delay += p.config.Jitter + 20*time.Millisecond
+		p.stats.Reordered++
+	}
+	if !lost || tcp {
+		p.stats.Delay += delay
+	}
+	return
+}
+
+func (p *Proxy) acceptRoutine() {
+	for {
+		conn, err := p.listener.AcceptTCP()
+		if err != nil {
+			// The listener was closed.
+			return
+		}
+		target, err := net.Dial("tcp", p.target)
+		if err != nil {
+			base.Warn().Printf("Unable to connect to %s: %v", p.target, err)
+			conn.Close()
+			continue
+		}
+		go p.tcpRoutine(conn, target)
+		go p.tcpRoutine(target, conn)
+	}
+}
+
+type tcpPacket struct {
+	data    []byte
+	deliver time.Time
+}
+
+// tcpRoutine forwards everything read from src to dst.  Packets are delivered
+// in the order they were read, so a delayed packet delays everything behind
+// it, just like it would with tcp.
+func (p *Proxy) tcpRoutine(src, dst net.Conn) {
+	packets := make(chan tcpPacket, 1000)
+	go func() {
+		defer dst.Close()
+		for packet := range packets {
+			time.Sleep(packet.deliver.Sub(time.Now()))
+			if _, err := dst.Write(packet.data); err != nil {
+				// Closing src stops the reader, drain anything it already sent so
+				// that it isn't blocked.
+				src.Close()
+				for _ = range packets {
+				}
+				return
+			}
+		}
+	}()
+	defer close(packets)
+	defer src.Close()
+	var last time.Time
+	for {
+		buf := make([]byte, maxPacketSize)
+		n, err := src.Read(buf)
+		if n > 0 {
+			delay, _, _ := p.delay(true)
+			deliver := time.Now().Add(delay)
+			if deliver.Before(last) {
+				deliver = last
+			}
+			last = deliver
+			packets <- tcpPacket{buf[0:n], deliver}
+		}
+		if err != nil {
+			if err != io.EOF {
+				base.Log().Printf("Proxy connection closed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// udpRoutine forwards packets from clients to the target.  Every client gets
+// its own connection to the target, so that replies can be sent back to it.
+func (p *Proxy) udpRoutine() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := p.udp.ReadFromUDP(buf)
+		if err != nil {
+			// The connection was closed.
+			return
+		}
+		session, err := p.udpSession(from)
+		if err != nil {
+			base.Warn().Printf("Unable to forward udp from %v to %s: %v", from, p.target, err)
+			continue
+		}
+		data := append([]byte(nil), buf[0:n]...)
+		p.sendLater(data, func(data []byte) { session.conn.Write(data) })
+	}
+}
+
+func (p *Proxy) udpSession(from *net.UDPAddr) (*udpSession, error) {
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	for addr, session := range p.sessions {
+		if now.Sub(session.last) > udpSessionTimeout {
+			session.conn.Close()
+			delete(p.sessions, addr)
+		}
+	}
+	if session, ok := p.sessions[from.String()]; ok {
+		session.last = now
+		return session, nil
+	}
+	addr, err := net.ResolveUDPAddr("udp", p.target)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	session := &udpSession{conn: conn, last: now}
+	p.sessions[from.String()] = session
+	go p.udpReplyRoutine(session, from)
+	return session, nil
+}
+
+// udpReplyRoutine forwards packets from the target back to the client at from.
+func (p *Proxy) udpReplyRoutine(session *udpSession, from *net.UDPAddr) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, err := session.conn.Read(buf)
+		if err != nil {
+			// The session timed out or the proxy was closed.
+			return
+		}
+		data := append([]byte(nil), buf[0:n]...)
+		p.sendLater(data, func(data []byte) { p.udp.WriteToUDP(data, from) })
+	}
+}
+
+// sendLater calls send with data after a delay, unless the packet is lost.
+// Udp packets are independent of each other, so each is delayed on its own.
+func (p *Proxy) sendLater(data []byte, send func([]byte)) {
+	delay, lost, _ := p.delay(false)
+	if lost {
+		return
+	}
+	time.AfterFunc(delay, func() { send(data) })
+}
@@ -0,0 +1,354 @@
+package netsim
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/runningwild/cgf"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+)
+
+const testLatency = 50 * time.Millisecond
+
+// Same as game.FrameMs, which isn't imported so that the tests don't need
+// graphics.
+const testFrameMs = 17
+
+// echoTCP starts a tcp server on a free loopback port that writes back
+// everything it reads, and returns its address.
+func echoTCP(t *testing.T) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// echoUDP starts a udp server on a free loopback port that sends every packet
+// back to where it came from, and returns its address.
+func echoUDP(t *testing.T) (string, func()) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf[0:n], from)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+// tcpRoundTrip sends msg through the proxy and returns how long it took for the
+// echo to come back.
+func tcpRoundTrip(t *testing.T, proxy *Proxy, msg string) time.Duration {
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", proxy.Port()))
+	if err != nil {
+		t.Fatalf("Unable to connect to the proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("Unable to write: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Unable to read the echo: %v", err)
+	}
+	if string(buf) != msg {
+		t.Errorf("Sent %q but got %q back", msg, buf)
+	}
+	return time.Since(start)
+}
+
+func TestTcpLatency(t *testing.T) {
+	target, stop := echoTCP(t)
+	defer stop()
+	proxy, err := Listen(Config{Latency: testLatency}, 0, target)
+	if err != nil {
+		t.Fatalf("Unable to start the proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	elapsed := tcpRoundTrip(t, proxy, "hello")
+	if elapsed < 2*testLatency {
+		t.Errorf("Round trip took %v, expected at least %v", elapsed, 2*testLatency)
+	}
+	stats := proxy.Stats()
+	if stats.Packets < 2 || stats.Lost != 0 || stats.Reordered != 0 {
+		t.Errorf("Expected at least 2 packets and nothing lost or reordered, got %v", stats)
+	}
+	if stats.Delay < time.Duration(stats.Packets)*testLatency {
+		t.Errorf("Expected at least %v of delay per packet, got %v", testLatency, stats)
+	}
+}
+
+func TestTcpLossIsRetransmitted(t *testing.T) {
+	target, stop := echoTCP(t)
+	defer stop()
+	proxy, err := Listen(Config{Latency: testLatency, Loss: 1}, 0, target)
+	if err != nil {
+		t.Fatalf("Unable to start the proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	// Every packet is lost, so each direction takes an extra round trip plus
+	// retransmitDelay.
+	elapsed := tcpRoundTrip(t, proxy, "hello")
+	expected := 2 * (3*testLatency + retransmitDelay)
+	if elapsed < expected {
+		t.Errorf("Round trip took %v, expected at least %v", elapsed, expected)
+	}
+	stats := proxy.Stats()
+	if stats.Packets == 0 || stats.Lost != stats.Packets {
+		t.Errorf("Expected every packet to be lost, got %v", stats)
+	}
+}
+
+func TestUdpLatency(t *testing.T) {
+	target, stop := echoUDP(t)
+	defer stop()
+	proxy, err := Listen(Config{Latency: testLatency}, 0, target)
+	if err != nil {
+		t.Fatalf("Unable to start the proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", proxy.Port()))
+	if err != nil {
+		t.Fatalf("Unable to connect to the proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("Unable to write: %v", err)
+	}
+	buf := make([]byte, maxPacketSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Unable to read the echo: %v", err)
+	}
+	if string(buf[0:n]) != "hello" {
+		t.Errorf("Sent %q but got %q back", "hello", buf[0:n])
+	}
+	if elapsed := time.Since(start); elapsed < 2*testLatency {
+		t.Errorf("Round trip took %v, expected at least %v", elapsed, 2*testLatency)
+	}
+	if stats := proxy.Stats(); stats.Packets != 2 || stats.Lost != 0 || stats.Delay < 2*testLatency {
+		t.Errorf("Expected 2 packets delayed by at least %v each, got %v", testLatency, stats)
+	}
+}
+
+func TestUdpLoss(t *testing.T) {
+	target, stop := echoUDP(t)
+	defer stop()
+	proxy, err := Listen(Config{Loss: 1}, 0, target)
+	if err != nil {
+		t.Fatalf("Unable to start the proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", proxy.Port()))
+	if err != nil {
+		t.Fatalf("Unable to connect to the proxy: %v", err)
+	}
+	defer conn.Close()
+	for i := 0; i < 10; i++ {
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			t.Fatalf("Unable to write: %v", err)
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, maxPacketSize)); err == nil {
+		t.Errorf("Expected every packet to be lost, but got %d bytes back", n)
+	}
+	if stats := proxy.Stats(); stats.Packets != 10 || stats.Lost != 10 {
+		t.Errorf("Expected 10 packets lost, got %v", stats)
+	}
+}
+
+// counterGame is the smallest state an engine can run, every addEvent adds to
+// Total.  Every stampedEvent adds how many frames it took to be applied to
+// DelayFrames, the same way the game measures the delay of Moves.
+type counterGame struct {
+	Frames int
+	Total  int
+
+	Stamped     int
+	DelayFrames int
+}
+
+func (g *counterGame) Think() {
+	g.Frames++
+}
+
+type addEvent struct {
+	N int
+}
+
+func (a addEvent) Apply(_g interface{}) {
+	g := _g.(*counterGame)
+	g.Total += a.N
+}
+
+// stampedEvent carries the frame the sending engine was on when it sent it.
+type stampedEvent struct {
+	Frame int
+}
+
+func (s stampedEvent) Apply(_g interface{}) {
+	g := _g.(*counterGame)
+	g.Stamped++
+	g.DelayFrames += g.Frames - s.Frame
+}
+
+func init() {
+	gob.Register(&counterGame{})
+	gob.Register(addEvent{})
+	gob.Register(stampedEvent{})
+}
+
+// freePort returns a loopback port that nothing is listening on.
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// waitForTotal waits until the engine's game has a Total of total.
+func waitForTotal(t *testing.T, engine *cgf.Engine, total int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		engine.Pause()
+		current := engine.GetState().(*counterGame).Total
+		engine.Unpause()
+		if current == total {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Engine %d has a total of %d, expected %d", engine.Id(), current, total)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEnginesThroughProxy(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	port := freePort(t)
+	host, err := cgf.NewHostEngine(&counterGame{}, testFrameMs, "", port, nil, logger)
+	if err != nil {
+		t.Fatalf("Unable to start the host engine: %v", err)
+	}
+	defer host.Kill()
+	proxy, err := Listen(Config{Latency: testLatency, Jitter: 10 * time.Millisecond, Seed: 1}, 0, fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Unable to start the proxy: %v", err)
+	}
+	defer proxy.Close()
+	client, err := cgf.NewClientEngine(testFrameMs, "127.0.0.1", proxy.Port(), nil, logger)
+	if err != nil {
+		t.Fatalf("Unable to connect the client engine through the proxy: %v", err)
+	}
+	defer client.Kill()
+
+	client.ApplyEvent(addEvent{3})
+	host.ApplyEvent(addEvent{4})
+	waitForTotal(t, host, 7)
+	waitForTotal(t, client, 7)
+
+	if stats := proxy.Stats(); stats.Packets == 0 || stats.Delay < time.Duration(stats.Packets)*testLatency {
+		t.Errorf("Expected every packet between the engines to be delayed by at least %v, got %v", testLatency, stats)
+	}
+}
+
+// measureInputDelay connects a client to a host through a proxy with latency,
+// sends stampedEvents from the client one at a time, and returns the average
+// number of frames they took to be applied on the client.
+func measureInputDelay(t *testing.T, latency time.Duration) float64 {
+	const events = 10
+	logger := log.New(ioutil.Discard, "", 0)
+	port := freePort(t)
+	host, err := cgf.NewHostEngine(&counterGame{}, testFrameMs, "", port, nil, logger)
+	if err != nil {
+		t.Fatalf("Unable to start the host engine: %v", err)
+	}
+	defer host.Kill()
+	proxy, err := Listen(Config{Latency: latency}, 0, fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Unable to start the proxy: %v", err)
+	}
+	defer proxy.Close()
+	client, err := cgf.NewClientEngine(testFrameMs, "127.0.0.1", proxy.Port(), nil, logger)
+	if err != nil {
+		t.Fatalf("Unable to connect the client engine through the proxy: %v", err)
+	}
+	defer client.Kill()
+
+	for i := 1; i <= events; i++ {
+		client.Pause()
+		frame := client.GetState().(*counterGame).Frames
+		client.Unpause()
+		client.ApplyEvent(stampedEvent{frame})
+		client.ApplyEvent(addEvent{1})
+		waitForTotal(t, client, i)
+	}
+	client.Pause()
+	defer client.Unpause()
+	g := client.GetState().(*counterGame)
+	if g.Stamped != events {
+		t.Fatalf("Expected %d events to be applied, got %d", events, g.Stamped)
+	}
+	return float64(g.DelayFrames) / events
+}
+
+func TestInputDelayFollowsLatency(t *testing.T) {
+	const latency = 100 * time.Millisecond
+	direct := measureInputDelay(t, 0)
+	delayed := measureInputDelay(t, latency)
+
+	// An event has to make it to the host and back, but only count one way so
+	// that scheduling on a busy machine can't fail the test.
+	expected := float64(latency/time.Millisecond) / testFrameMs
+	if delayed-direct < expected {
+		t.Errorf("Expected %v of latency to add at least %.1f frames of delay, went from %.1f to %.1f frames", latency, expected, direct, delayed)
+	}
+	if most := direct + 4*expected; delayed > most {
+		t.Errorf("Expected %v of latency to add roughly %.1f frames of delay each way, went from %.1f to %.1f frames", latency, expected, direct, delayed)
+	}
+}
+
+func TestStatsString(t *testing.T) {
+	if s := (Stats{}).String(); s != "no packets" {
+		t.Errorf("Expected %q, got %q", "no packets", s)
+	}
+	s := Stats{Packets: 4, Lost: 1, Reordered: 2, Delay: 400 * time.Millisecond}.String()
+	if expected := "4 packets, 1 lost, 2 reordered, 100ms average delay"; s != expected {
+		t.Errorf("Expected %q, got %q", expected, s)
+	}
+}
@@ -0,0 +1,105 @@
+// +build nographics
+
+// The replay binary plays back a replay recorded with -record and prints the
+// state of the game at the requested frames.  Build it with the nographics
+// tag:
+//   go build --tags nographics ./replay
+package main
+
+import (
+	"flag"
+	"fmt"
+	_ "github.com/runningwild/jota/ability"
+	_ "github.com/runningwild/jota/ability/control_point"
+	_ "github.com/runningwild/jota/ability/creep"
+	"github.com/runningwild/jota/base"
+	_ "github.com/runningwild/jota/effects"
+	"github.com/runningwild/jota/game"
+	"os"
+)
+
+var (
+	dataDir = flag.String("data", "../data", "Path to the data directory.")
+	frame   = flag.Int("frame", -1, "Frame to print the state of, -1 is the end of the replay.")
+	every   = flag.Int("every", 0, "If positive, also print the state every this many frames.")
+	verify  = flag.Bool("verify", false, "Check that the game survives being sent to a joining engine each time the state is printed.")
+)
+
+func printState(g *game.Game) {
+	fmt.Printf("Frame %d\n", g.Frame)
+	if g.Setup != nil {
+		fmt.Printf("  In setup, room %s\n", g.Setup.Room)
+		base.DoOrdered(g.Setup.Players, func(a, b int64) bool { return a < b }, func(id int64, player *game.SetupPlayerData) {
+			fmt.Printf("  Engine %d: side %d, champ %d, ship %d\n", id, player.Side, player.ChampIndex, player.ShipIndex)
+		})
+		return
+	}
+	g.DoForEnts(func(gid game.Gid, ent game.Ent) {
+		fmt.Printf("  %-10s side %2d pos (%.2f, %.2f) vel (%.2f, %.2f) health %.2f/%.2f\n",
+			gid, ent.Side(), ent.Pos().X, ent.Pos().Y, ent.Vel().X, ent.Vel().Y,
+			ent.Stats().HealthCur(), ent.Stats().HealthMax())
+	})
+}
+
+// verifyEncoding prints any problems that would come up sending the game to an
+// engine joining it in progress, and returns false if there were any.
+func verifyEncoding(g *game.Game) bool {
+	if !*verify {
+		return true
+	}
+	if err := g.VerifyEncoding(); err != nil {
+		fmt.Printf("Frame %d: %v\n", g.Frame, err)
+		return false
+	}
+	return true
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Printf("Usage: replay [flags] file\n")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	base.SetDatadir(*dataDir)
+	defer base.CloseLog()
+
+	rp, err := game.LoadReplay(flag.Arg(0))
+	if err != nil {
+		fmt.Printf("Unable to load replay: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Replay runs from frame %d to frame %d\n", rp.Frame(), rp.EndFrame())
+	target := *frame
+	if target < 0 || target > rp.EndFrame() {
+		target = rp.EndFrame()
+	}
+	if *every > 0 {
+		ok := true
+		for rp.Frame() < target {
+			next := rp.Frame() + *every
+			if next > target {
+				next = target
+			}
+			rp.Seek(next)
+			printState(rp.Game())
+			ok = verifyEncoding(rp.Game()) && ok
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+	err = rp.Seek(target)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	printState(rp.Game())
+	for _, desync := range rp.Game().Desyncs() {
+		fmt.Printf("Replay diverged from recorded checksum from %s\n", desync)
+	}
+	if !verifyEncoding(rp.Game()) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,357 @@
+package script
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/agora/compiler"
+	"github.com/PuerkitoBio/agora/runtime"
+	"github.com/runningwild/cgf"
+	"github.com/runningwild/jota/base"
+	"github.com/runningwild/jota/game"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Scripts can fail because of a bug in the script, because they called a jota
+// function with bad arguments, or because they ran for too long without
+// sleeping.  When one fails the error is logged, with the script's file and
+// line when agora reports them, and after a while the script is started again
+// from the beginning with a new module.  The wait doubles every time the
+// script fails, until it manages to run for stableFrames.
+//
+// Agora has no way to interrupt a script, so a script can only be stopped when
+// it calls a jota function or sleeps.  A script that loops without doing
+// either is caught by a watchdog instead, which reports it as failed and gives
+// up on it.  Its goroutine keeps spinning, since there's no way to stop it, so
+// the script isn't started again until it changes.
+
+const (
+	// Panicking with this stops a script without it counting as a failure.
+	errTerminated = "module terminated"
+
+	// Longest a script that isn't ticked may run without sleeping, checked
+	// whenever it calls a jota function.
+	maxTimeAwake = time.Second
+
+	// A script that isn't ticked and has run for this long without sleeping
+	// can't be calling any jota functions, so the watchdog gives up on it.  The
+	// watchdog checks every hungCheckInterval.
+	hungTime          = 5 * time.Second
+	hungCheckInterval = time.Second
+
+	// Longest Tick waits for a ticked script before giving up on it.
+	hungTickTime = time.Second
+
+	// Ticks that take longer than this are logged, since the game waits for
+	// them.
+	slowTickTime = 100 * time.Millisecond
+
+	// Frames to wait before restarting a script the first time it fails, and
+	// the most frames to wait no matter how often it fails.
+	minRestartFrames = 60
+	maxRestartFrames = 60 * 60
+
+	// Scripts that fail after running for this many frames are restarted after
+	// minRestartFrames again.
+	stableFrames = 30 * 60
+)
+
+// Matches the line number in errors from agora.
+var scriptLineRegexp = regexp.MustCompile(`(?:\.agora:|\bline )(\d+)`)
+
+type GameAi struct {
+	name   string
+	engine *cgf.Engine
+	gid    game.Gid
+	ticked bool
+
+	paramsMutex sync.Mutex
+	params      map[string]interface{}
+
+	// Closed when the Ai is terminated.
+	stop chan struct{}
+
+	statusMutex sync.Mutex
+	status      game.AiStatus
+
+	// Frames waited before the most recent restart.
+	restartFrames int
+
+	// The module the script is running in, nil while it isn't running.  Only
+	// accessed with statusMutex held, except by ticked Ais.
+	jm *JotaModule
+
+	// Ticked Ais start their script on restartFrame, and the current run
+	// started on runFrame and loaded deps.
+	restartFrame int
+	runFrame     int
+	deps         *scriptDeps
+
+	// Set when the watchdog gave up on the script, only accessed with
+	// statusMutex held.  The script isn't started again until it changes.
+	hung bool
+}
+
+func init() {
+	game.RegisterAiMaker(Maker)
+}
+
+func Maker(name string, engine *cgf.Engine, gid game.Gid, ticked bool) game.Ai {
+	return &GameAi{
+		name:   name,
+		engine: engine,
+		gid:    gid,
+		ticked: ticked,
+		params: make(map[string]interface{}),
+		stop:   make(chan struct{}),
+	}
+}
+
+func (ai *GameAi) Start() {
+	if ai.ticked {
+		// Ticked scripts are started by Tick.
+		return
+	}
+	go ai.run()
+}
+
+func (ai *GameAi) Stop() {
+}
+
+func (ai *GameAi) Terminate() {
+	ai.statusMutex.Lock()
+	defer ai.statusMutex.Unlock()
+	if ai.status.State == game.AiTerminated {
+		return
+	}
+	ai.status.State = game.AiTerminated
+	close(ai.stop)
+	if ai.jm != nil {
+		ai.jm.halt()
+		ai.jm = nil
+	}
+}
+
+func (ai *GameAi) Status() game.AiStatus {
+	ai.statusMutex.Lock()
+	defer ai.statusMutex.Unlock()
+	return ai.status
+}
+
+// setState changes the state of the Ai, unless it has been terminated.
+func (ai *GameAi) setState(state game.AiState) {
+	ai.statusMutex.Lock()
+	defer ai.statusMutex.Unlock()
+	if ai.status.State != game.AiTerminated {
+		ai.status.State = state
+	}
+}
+
+// setModule sets the module the script is running in.  Returns false if the
+// Ai has been terminated, in which case the script shouldn't be run.
+func (ai *GameAi) setModule(jm *JotaModule) bool {
+	ai.statusMutex.Lock()
+	defer ai.statusMutex.Unlock()
+	if ai.status.State == game.AiTerminated {
+		return false
+	}
+	ai.jm = jm
+	return true
+}
+
+// newModule makes a module to run the script in.  Every time the script is
+// started it gets a new module, and only the params are kept.
+func (ai *GameAi) newModule() *JotaModule {
+	jm := &JotaModule{
+		engine:        ai.engine,
+		myGid:         ai.gid,
+		name:          ai.name,
+		ai:            ai,
+		stop:          make(chan struct{}),
+		gidToAgoraEnt: make(map[game.Gid]*agoraEnt),
+	}
+	if ai.ticked {
+		jm.ticker = makeTicker()
+	}
+	return jm
+}
+
+// load compiles the script for jm, loading the scripts through deps.
+func (ai *GameAi) load(jm *JotaModule, deps *scriptDeps) (runtime.Module, error) {
+	ctx := runtime.NewCtx(deps, new(compiler.Compiler))
+	ctx.RegisterNativeModule(&timeModule{jm: jm})
+	ctx.RegisterNativeModule(&LogModule{})
+	ctx.RegisterNativeModule(jm)
+	return ctx.Load(ai.name)
+}
+
+// runScript runs mod until it returns, converting any panic that agora
+// doesn't catch into an error.
+func runScript(mod runtime.Module) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	_, err = mod.Run()
+	return err
+}
+
+// run runs a script that isn't ticked, restarting it whenever it fails or
+// changes.
+func (ai *GameAi) run() {
+	for {
+		jm := ai.newModule()
+		if !ai.setModule(jm) {
+			return
+		}
+		deps := newScriptDeps(getGlobalJotaResolver())
+		start := time.Now()
+		mod, err := ai.load(jm, deps)
+		if err == nil {
+			go func() {
+				<-deps.untilStale(jm.stop)
+				jm.halt()
+			}()
+			ai.setState(game.AiRunning)
+			jm.setAwake()
+			err = ai.runWatched(jm, mod)
+			jm.halt()
+		}
+		ai.setModule(nil)
+		select {
+		case <-ai.stop:
+			return
+		default:
+		}
+		if deps.stale() {
+			ai.reloaded()
+			continue
+		}
+		if ai.isHung() {
+			// The watchdog already reported this failure.
+			done := make(chan struct{})
+			select {
+			case <-ai.stop:
+			case <-deps.untilStale(done):
+				ai.reloaded()
+			}
+			close(done)
+			continue
+		}
+		if err == nil {
+			ai.finished()
+			return
+		}
+		ran := int(time.Since(start) / (game.FrameMs * time.Millisecond))
+		frames := ai.failed(err, ran)
+		done := make(chan struct{})
+		select {
+		case <-ai.stop:
+		case <-time.After(time.Duration(frames) * game.FrameMs * time.Millisecond):
+		case <-deps.untilStale(done):
+			ai.reloaded()
+		}
+		close(done)
+	}
+}
+
+// runWatched runs the script and waits for it to return, unless it stays awake
+// for hungTime.  Then the watchdog gives up on it and returns without waiting,
+// leaving the script's goroutine running.
+func (ai *GameAi) runWatched(jm *JotaModule, mod runtime.Module) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- runScript(mod)
+	}()
+	ticker := time.NewTicker(hungCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+		}
+		if jm.awakeFor() > hungTime {
+			err := fmt.Errorf("ran for more than %v without sleeping or calling a jota function", hungTime)
+			ai.hang(err)
+			return err
+		}
+	}
+}
+
+// hang reports that the script ran for too long without giving control back,
+// after which it isn't started again until it changes.
+func (ai *GameAi) hang(err error) {
+	ai.statusMutex.Lock()
+	ai.hung = true
+	ai.statusMutex.Unlock()
+	ai.failed(err, 0)
+}
+
+func (ai *GameAi) isHung() bool {
+	ai.statusMutex.Lock()
+	defer ai.statusMutex.Unlock()
+	return ai.hung
+}
+
+// reloaded is called when the script is restarted because it changed.
+func (ai *GameAi) reloaded() {
+	base.Log().Printf("Restarting script %s with its new code", ai.path())
+	ai.restartFrames = 0
+	ai.statusMutex.Lock()
+	ai.hung = false
+	ai.statusMutex.Unlock()
+}
+
+func (ai *GameAi) finished() {
+	base.Log().Printf("Script %s finished", ai.path())
+	ai.setState(game.AiFinished)
+}
+
+// failed reports that the script failed after running for ran frames, and
+// returns how many frames to wait before restarting it.
+func (ai *GameAi) failed(err error, ran int) int {
+	if ran >= stableFrames {
+		ai.restartFrames = 0
+	}
+	if ai.restartFrames == 0 {
+		ai.restartFrames = minRestartFrames
+	} else {
+		ai.restartFrames *= 2
+		if ai.restartFrames > maxRestartFrames {
+			ai.restartFrames = maxRestartFrames
+		}
+	}
+	msg := ai.describe(err)
+	if ai.isHung() {
+		base.Error().Printf("Script error in %s, it won't be restarted until it changes", msg)
+	} else {
+		wait := time.Duration(ai.restartFrames) * game.FrameMs * time.Millisecond
+		base.Error().Printf("Script error in %s, restarting in %v", msg, wait)
+	}
+
+	ai.statusMutex.Lock()
+	defer ai.statusMutex.Unlock()
+	if ai.status.State != game.AiTerminated {
+		ai.status.State = game.AiErrored
+	}
+	ai.status.Err = msg
+	ai.status.Failures++
+	return ai.restartFrames
+}
+
+// path returns the script's file, relative to the data directory.
+func (ai *GameAi) path() string {
+	return filepath.Join("scripts", ai.name+".agora")
+}
+
+// describe returns err prefixed with the script's file, and the line if it
+// can be found in err.
+func (ai *GameAi) describe(err error) string {
+	if match := scriptLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+		return fmt.Sprintf("%s:%s: %v", ai.path(), match[1], err)
+	}
+	return fmt.Sprintf("%s: %v", ai.path(), err)
+}
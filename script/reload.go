@@ -0,0 +1,124 @@
+package script
+
+import (
+	"github.com/runningwild/jota/base"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Scripts can be changed while the game is running.  The resolver checks the
+// scripts it has cached every scriptPollInterval and forgets any that have
+// changed on disk.  Every time an Ai starts its script it keeps track of which
+// scripts that loaded, and once any of them change it starts its script again
+// from the beginning, which loads the new code.  The Ai's params are kept, so
+// the script carries on with the same settings.  An Ai waiting to restart after
+// its script failed restarts as soon as the script changes, since the change
+// is probably a fix.
+
+// How often cached scripts are checked for changes.
+const scriptPollInterval = 500 * time.Millisecond
+
+func (jr *jotaResolver) watch() {
+	for _ = range time.Tick(scriptPollInterval) {
+		jr.poll()
+	}
+}
+
+// poll forgets every cached script that has changed on disk, so that it is
+// loaded again the next time it's resolved.
+func (jr *jotaResolver) poll() {
+	jr.cacheMutex.Lock()
+	defer jr.cacheMutex.Unlock()
+	var changed []string
+	for id, script := range jr.cache {
+		info, err := os.Stat(jr.path(id))
+		if err != nil || !info.ModTime().Equal(script.modTime) {
+			changed = append(changed, id)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	sort.Strings(changed)
+	jr.version++
+	for _, id := range changed {
+		delete(jr.cache, id)
+		jr.changed[id] = jr.version
+		base.Log().Printf("Script %s changed, reloading it", jr.path(id))
+	}
+	close(jr.reload)
+	jr.reload = make(chan struct{})
+}
+
+// reloaded returns a channel that is closed the next time any cached scripts
+// change.
+func (jr *jotaResolver) reloaded() <-chan struct{} {
+	jr.cacheMutex.Lock()
+	defer jr.cacheMutex.Unlock()
+	return jr.reload
+}
+
+// scriptDeps resolves scripts for a single run of an Ai's script, and keeps
+// track of which scripts were loaded.
+type scriptDeps struct {
+	jr *jotaResolver
+
+	// Version of jr when the run started.
+	version int
+
+	// Every script that has been resolved, only touched while jr's cache is
+	// locked.
+	ids []string
+}
+
+func newScriptDeps(jr *jotaResolver) *scriptDeps {
+	jr.cacheMutex.Lock()
+	defer jr.cacheMutex.Unlock()
+	return &scriptDeps{jr: jr, version: jr.version}
+}
+
+func (d *scriptDeps) Resolve(id string) (io.Reader, error) {
+	d.jr.cacheMutex.Lock()
+	d.ids = append(d.ids, id)
+	d.jr.cacheMutex.Unlock()
+	return d.jr.Resolve(id)
+}
+
+// stale returns true if any of the scripts that were loaded have changed
+// since.
+func (d *scriptDeps) stale() bool {
+	d.jr.cacheMutex.Lock()
+	defer d.jr.cacheMutex.Unlock()
+	if d.jr.version == d.version {
+		return false
+	}
+	for _, id := range d.ids {
+		if d.jr.changed[id] > d.version {
+			return true
+		}
+	}
+	return false
+}
+
+// untilStale returns a channel that is closed once the scripts that were
+// loaded have changed, or once stop is closed.
+func (d *scriptDeps) untilStale(stop <-chan struct{}) <-chan struct{} {
+	c := make(chan struct{})
+	go func() {
+		defer close(c)
+		for {
+			reloaded := d.jr.reloaded()
+			if d.stale() {
+				return
+			}
+			select {
+			case <-reloaded:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return c
+}
@@ -3,40 +3,65 @@ package script
 import (
 	"bytes"
 	"fmt"
-	"github.com/PuerkitoBio/agora/compiler"
 	"github.com/PuerkitoBio/agora/runtime"
-	"github.com/PuerkitoBio/agora/runtime/stdlib"
 	"github.com/runningwild/cgf"
 	"github.com/runningwild/jota/base"
 	"github.com/runningwild/jota/game"
+	"github.com/runningwild/jota/stats"
 	"github.com/runningwild/linear"
 	"io"
 	"io/ioutil"
 	"math"
+	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// jotaResolver loads scripts from the scripts directory.  Scripts are cached
+// once they have been read, and reloaded once they change, see poll.
 type jotaResolver struct {
 	root string
 
 	cacheMutex sync.Mutex
-	cache      map[string][]byte
+	cache      map[string]cachedScript
+
+	// Incremented whenever cached scripts change, changed holds the version
+	// that each script last changed in.  reload is closed and replaced
+	// whenever version is incremented.
+	version int
+	changed map[string]int
+	reload  chan struct{}
+}
+
+type cachedScript struct {
+	data    []byte
+	modTime time.Time
+}
+
+func (jr *jotaResolver) path(id string) string {
+	return filepath.Join(jr.root, id+".agora")
 }
 
-func (jr jotaResolver) Resolve(id string) (io.Reader, error) {
+func (jr *jotaResolver) Resolve(id string) (io.Reader, error) {
 	jr.cacheMutex.Lock()
 	defer jr.cacheMutex.Unlock()
-	if data, ok := jr.cache[id]; ok {
-		return bytes.NewReader(data), nil
+	if script, ok := jr.cache[id]; ok {
+		return bytes.NewReader(script.data), nil
 	}
-	base.Log().Printf("Opening: %s", jr.root)
-	data, err := ioutil.ReadFile(filepath.Join(jr.root, id+".agora"))
+	path := jr.path(id)
+	base.Log().Printf("Opening: %s", path)
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	jr.cache[id] = data
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jr.cache[id] = cachedScript{data: data, modTime: info.ModTime()}
 	return bytes.NewReader(data), nil
 }
 
@@ -46,9 +71,12 @@ var globalJotaResolver jotaResolver
 func getGlobalJotaResolver() *jotaResolver {
 	globalJotaResolverOnce.Do(func() {
 		globalJotaResolver = jotaResolver{
-			cache: make(map[string][]byte),
-			root:  filepath.Join(base.GetDataDir(), "scripts"),
+			cache:   make(map[string]cachedScript),
+			root:    filepath.Join(base.GetDataDir(), "scripts"),
+			changed: make(map[string]int),
+			reload:  make(chan struct{}),
 		}
+		go globalJotaResolver.watch()
 	})
 	return &globalJotaResolver
 }
@@ -97,11 +125,22 @@ type JotaModule struct {
 	// The returned value
 	ob runtime.Object
 
-	// The engine.  The context needs this because all functions that look at any
-	// game state will need to pause the engine so the data isn't changed
-	// underneath it.
+	// The engine, used to send events.  Game state is only ever looked at
+	// through snapshots, so the engine is never paused while a script runs.
 	engine *cgf.Engine
 
+	// Set if the script is ticked, see game.TickedAi.
+	ticker *ticker
+
+	// The game, found the first time the script needs a snapshot.
+	gameOnce sync.Once
+	game     *game.Game
+
+	// The snapshot the script is looking at and when it last looked at it,
+	// see snapshot.
+	current  *game.Snapshot
+	lastLook time.Time
+
 	// Name of the script that this module will load.
 	name string
 
@@ -109,7 +148,18 @@ type JotaModule struct {
 	// entity when needed.
 	myGid game.Gid
 
-	terminated bool
+	// The Ai running this module, which keeps the script's params.
+	ai *GameAi
+
+	// Closed by halt when the script should stop, either because the Ai was
+	// terminated or because the script is being restarted.
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// When the script last started running or woke up from sleeping, in
+	// nanoseconds since the epoch, or 0 while it's sleeping.  Only accessed
+	// atomically since the watchdog reads it, see maxTimeAwake and hungTime.
+	awake int64
 
 	// These keep track of the ai's virtual controller
 	controller struct {
@@ -117,17 +167,53 @@ type JotaModule struct {
 		acc   float64 // [-1.0, 1.0]
 	}
 
-	paramsMutex sync.Mutex
-	params      map[string]interface{}
-
 	gidToAgoraEntMutex sync.Mutex
 	gidToAgoraEnt      map[game.Gid]*agoraEnt
 }
 
+// dieOnTerminated is called at the start of every jota function.  Scripts
+// that aren't ticked are stopped here once they have run for too long without
+// sleeping.  Ticked scripts are made to wait for the next frame here once they
+// have made maxTickedCalls calls in the current one.
 func (jm *JotaModule) dieOnTerminated() {
-	if jm.terminated {
-		panic("module terminated")
+	select {
+	case <-jm.stop:
+		panic(errTerminated)
+	default:
+	}
+	if jm.ticker == nil {
+		if jm.awakeFor() > maxTimeAwake {
+			panic(fmt.Sprintf("ran for more than %v without sleeping", maxTimeAwake))
+		}
+		return
 	}
+	jm.ticker.calls++
+	if jm.ticker.calls > maxTickedCalls && !jm.wait(jm.ticker.frame+1) {
+		panic(errTerminated)
+	}
+}
+
+func (jm *JotaModule) setAwake() {
+	atomic.StoreInt64(&jm.awake, time.Now().UnixNano())
+}
+
+func (jm *JotaModule) setAsleep() {
+	atomic.StoreInt64(&jm.awake, 0)
+}
+
+// awakeFor returns how long the script has been running since it started or
+// last woke up, or 0 while it's sleeping.
+func (jm *JotaModule) awakeFor() time.Duration {
+	awake := atomic.LoadInt64(&jm.awake)
+	if awake == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, awake))
+}
+
+// halt stops the script the next time it calls a jota function or sleeps.
+func (jm *JotaModule) halt() {
+	jm.stopOnce.Do(func() { close(jm.stop) })
 }
 
 func (jm *JotaModule) ID() string {
@@ -137,6 +223,50 @@ func (jm *JotaModule) SetCtx(ctx *runtime.Ctx) {
 	jm.ctx = ctx
 }
 
+// snapshot returns the snapshot the script should look at, which may be nil
+// before the first frame.  The script keeps looking at the same snapshot
+// until it acts or until it stops looking for at least a frame, so that
+// everything it looks at while making a decision comes from the same frame.
+// Ticked scripts always look at the snapshot of the frame they are ticked on.
+func (jm *JotaModule) snapshot() *game.Snapshot {
+	if jm.ticker != nil {
+		return jm.current
+	}
+	jm.gameOnce.Do(func() {
+		jm.engine.Pause()
+		jm.game = jm.engine.GetState().(*game.Game)
+		jm.engine.Unpause()
+	})
+	now := time.Now()
+	if jm.current == nil || now.Sub(jm.lastLook) > game.FrameMs*time.Millisecond {
+		jm.current = jm.game.Snapshot()
+	}
+	jm.lastLook = now
+	return jm.current
+}
+
+// send sends an event for the script.  Afterwards the script looks at a new
+// snapshot to see what happened.  Events sent by ticked scripts are kept until
+// the end of the tick.
+func (jm *JotaModule) send(event game.Event) {
+	if jm.ticker != nil {
+		jm.ticker.events = append(jm.ticker.events, event)
+		return
+	}
+	jm.engine.ApplyEvent(event)
+	jm.current = nil
+}
+
+// ent returns the ent with the specified gid from the current snapshot, or
+// nil if it doesn't exist.
+func (jm *JotaModule) ent(gid game.Gid) *game.EntSnapshot {
+	s := jm.snapshot()
+	if s == nil {
+		return nil
+	}
+	return s.Ents[gid]
+}
+
 func (jm *JotaModule) newEnt(gid game.Gid) *agoraEnt {
 	jm.gidToAgoraEntMutex.Lock()
 	defer jm.gidToAgoraEntMutex.Unlock()
@@ -156,6 +286,11 @@ func (jm *JotaModule) newEnt(gid game.Gid) *agoraEnt {
 		ob.Set(runtime.String("IsControlPoint"), runtime.NewNativeFunc(jm.ctx, "jota.Ent.IsControlPoint", ent.isType(game.EntTypeControlPoint)))
 		ob.Set(runtime.String("IsObstacle"), runtime.NewNativeFunc(jm.ctx, "jota.Ent.IsObstacle", ent.isType(game.EntTypeObstacle)))
 		ob.Set(runtime.String("IsProjectile"), runtime.NewNativeFunc(jm.ctx, "jota.Ent.IsProjectile", ent.isType(game.EntTypeProjectile)))
+		ob.Set(runtime.String("Health"), runtime.NewNativeFunc(jm.ctx, "jota.Ent.Health", ent.health))
+		ob.Set(runtime.String("MaxHealth"), runtime.NewNativeFunc(jm.ctx, "jota.Ent.MaxHealth", ent.maxHealth))
+		ob.Set(runtime.String("Stats"), runtime.NewNativeFunc(jm.ctx, "jota.Ent.Stats", ent.stats))
+		ob.Set(runtime.String("Processes"), runtime.NewNativeFunc(jm.ctx, "jota.Ent.Processes", ent.processes))
+		ob.Set(runtime.String("Abilities"), runtime.NewNativeFunc(jm.ctx, "jota.Ent.Abilities", ent.abilities))
 		jm.gidToAgoraEnt[gid] = ent
 	}
 	return jm.gidToAgoraEnt[gid]
@@ -168,55 +303,136 @@ type agoraEnt struct {
 }
 
 func (aEnt *agoraEnt) side(args ...runtime.Val) runtime.Val {
-	aEnt.jm.engine.Pause()
-	defer aEnt.jm.engine.Unpause()
-	ent := aEnt.jm.engine.GetState().(*game.Game).Ents[aEnt.gid]
+	ent := aEnt.jm.ent(aEnt.gid)
 	if ent == nil {
 		return runtime.Nil
 	}
-	return runtime.Number(ent.Side())
+	return runtime.Number(ent.Side)
 }
 
 func (aEnt *agoraEnt) pos(args ...runtime.Val) runtime.Val {
-	aEnt.jm.engine.Pause()
-	defer aEnt.jm.engine.Unpause()
-	ent := aEnt.jm.engine.GetState().(*game.Game).Ents[aEnt.gid]
+	ent := aEnt.jm.ent(aEnt.gid)
 	if ent == nil {
 		return runtime.Nil
 	}
-	return aEnt.jm.newVec(ent.Pos().X, ent.Pos().Y)
+	return aEnt.jm.newVec(ent.Pos.X, ent.Pos.Y)
 }
 
 func (aEnt *agoraEnt) vel(args ...runtime.Val) runtime.Val {
-	aEnt.jm.engine.Pause()
-	defer aEnt.jm.engine.Unpause()
-	ent := aEnt.jm.engine.GetState().(*game.Game).Ents[aEnt.gid]
+	ent := aEnt.jm.ent(aEnt.gid)
 	if ent == nil {
 		return runtime.Nil
 	}
-	return aEnt.jm.newVec(ent.Vel().X, ent.Vel().Y)
+	return aEnt.jm.newVec(ent.Vel.X, ent.Vel.Y)
 }
 
 func (aEnt *agoraEnt) angle(args ...runtime.Val) runtime.Val {
-	aEnt.jm.engine.Pause()
-	defer aEnt.jm.engine.Unpause()
-	ent := aEnt.jm.engine.GetState().(*game.Game).Ents[aEnt.gid]
+	ent := aEnt.jm.ent(aEnt.gid)
 	if ent == nil {
 		return runtime.Nil
 	}
-	return runtime.Number(ent.Angle())
+	return runtime.Number(ent.Angle)
 }
 
 func (aEnt *agoraEnt) isType(entType game.EntType) runtime.FuncFn {
 	return func(args ...runtime.Val) runtime.Val {
-		aEnt.jm.engine.Pause()
-		defer aEnt.jm.engine.Unpause()
-		ent := aEnt.jm.engine.GetState().(*game.Game).Ents[aEnt.gid]
+		ent := aEnt.jm.ent(aEnt.gid)
 		if ent == nil {
 			return runtime.Bool(false)
 		}
-		return runtime.Bool(ent.Type() == entType)
+		return runtime.Bool(ent.Type == entType)
+	}
+}
+
+func (aEnt *agoraEnt) health(args ...runtime.Val) runtime.Val {
+	ent := aEnt.jm.ent(aEnt.gid)
+	if ent == nil {
+		return runtime.Nil
 	}
+	return runtime.Number(ent.Health)
+}
+
+func (aEnt *agoraEnt) maxHealth(args ...runtime.Val) runtime.Val {
+	ent := aEnt.jm.ent(aEnt.gid)
+	if ent == nil {
+		return runtime.Nil
+	}
+	return runtime.Number(ent.MaxHealth)
+}
+
+// stats returns an object with the ent's current stats, including any changes
+// made by its conditions.
+func (aEnt *agoraEnt) stats(args ...runtime.Val) runtime.Val {
+	ent := aEnt.jm.ent(aEnt.gid)
+	if ent == nil {
+		return runtime.Nil
+	}
+	ob := runtime.NewObject()
+	ob.Set(runtime.String("Health"), runtime.Number(ent.Health))
+	ob.Set(runtime.String("MaxHealth"), runtime.Number(ent.MaxHealth))
+	ob.Set(runtime.String("Mass"), runtime.Number(ent.Mass))
+	ob.Set(runtime.String("MaxTurn"), runtime.Number(ent.MaxTurn))
+	ob.Set(runtime.String("MaxAcc"), runtime.Number(ent.MaxAcc))
+	ob.Set(runtime.String("MaxRate"), runtime.Number(ent.MaxRate))
+	ob.Set(runtime.String("Cloaking"), runtime.Number(ent.Cloaking))
+	ob.Set(runtime.String("Size"), runtime.Number(ent.Size))
+	ob.Set(runtime.String("Vision"), runtime.Number(ent.Vision))
+	armor := runtime.NewObject()
+	resistance := runtime.NewObject()
+	for kind, name := range damageKindNames {
+		armor.Set(runtime.String(name), runtime.Number(ent.Armor.Get(kind)))
+		resistance.Set(runtime.String(name), runtime.Number(ent.Resistance.Get(kind)))
+	}
+	ob.Set(runtime.String("Armor"), armor)
+	ob.Set(runtime.String("Resistance"), resistance)
+	return ob
+}
+
+var damageKindNames = map[stats.DamageKind]string{
+	stats.DamageFire:     "Fire",
+	stats.DamageAcid:     "Acid",
+	stats.DamageCrushing: "Crushing",
+}
+
+// processes returns a list of the processes on the ent.  Each one has the
+// Name of its type, and the Damage of DamageKind that it does every frame.
+// DamageKind is only set on processes that do damage.
+func (aEnt *agoraEnt) processes(args ...runtime.Val) runtime.Val {
+	ent := aEnt.jm.ent(aEnt.gid)
+	obj := runtime.NewObject()
+	if ent == nil {
+		return obj
+	}
+	for i, proc := range ent.Processes {
+		ob := runtime.NewObject()
+		ob.Set(runtime.String("Name"), runtime.String(proc.Name))
+		ob.Set(runtime.String("Damage"), runtime.Number(proc.Damage.Amt))
+		if proc.Damage.Amt > 0 {
+			ob.Set(runtime.String("DamageKind"), runtime.String(damageKindNames[proc.Damage.Kind]))
+		}
+		obj.Set(runtime.Number(i), ob)
+	}
+	return obj
+}
+
+// abilities returns a list of the ent's abilities, in the order that they are
+// used by UseAbility.  Each one has a Name, if the ent is a player, and
+// IsActive, which is true while it is being used.
+func (aEnt *agoraEnt) abilities(args ...runtime.Val) runtime.Val {
+	ent := aEnt.jm.ent(aEnt.gid)
+	obj := runtime.NewObject()
+	if ent == nil {
+		return obj
+	}
+	for i, ab := range ent.Abilities {
+		ob := runtime.NewObject()
+		if ab.Name != "" {
+			ob.Set(runtime.String("Name"), runtime.String(ab.Name))
+		}
+		ob.Set(runtime.String("IsActive"), runtime.Bool(ab.IsActive))
+		obj.Set(runtime.Number(i), ob)
+	}
+	return obj
 }
 
 // Not interested in any argument in this case. Note the named return values.
@@ -238,21 +454,21 @@ func (jm *JotaModule) Run(_ ...runtime.Val) (v runtime.Val, err error) {
 		jm.ob.Set(runtime.String("ControlPoints"), runtime.NewNativeFunc(jm.ctx, "jota.ControlPoints", jm.ControlPoints))
 		jm.ob.Set(runtime.String("NearbyEnts"), runtime.NewNativeFunc(jm.ctx, "jota.NearbyEnts", jm.NearbyEnts))
 		jm.ob.Set(runtime.String("PathDir"), runtime.NewNativeFunc(jm.ctx, "jota.PathDir", jm.PathDir))
+		jm.ob.Set(runtime.String("ManaNear"), runtime.NewNativeFunc(jm.ctx, "jota.ManaNear", jm.ManaNear))
+		jm.ob.Set(runtime.String("CanSee"), runtime.NewNativeFunc(jm.ctx, "jota.CanSee", jm.CanSee))
 	}
 	return jm.ob, nil
 }
 
 func (jm *JotaModule) Me(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
-	jm.engine.Pause()
-	defer jm.engine.Unpause()
 	return jm.newEnt(jm.myGid)
 }
 
 func (jm *JotaModule) Move(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
 	jm.controller.acc = vs[0].Float()
-	jm.engine.ApplyEvent(game.Move{jm.myGid, jm.controller.angle, jm.controller.acc})
+	jm.send(game.Move{Gid: jm.myGid, Angle: jm.controller.angle, Magnitude: jm.controller.acc})
 	return runtime.Nil
 }
 
@@ -263,30 +479,26 @@ func (jm *JotaModule) MoveTowards(vs ...runtime.Val) runtime.Val {
 		base.Warn().Printf("Script called MoveTowards with the wrong type: %T", vs[0].Native())
 		return runtime.Nil
 	}
-	jm.engine.Pause()
-	defer jm.engine.Unpause()
-
-	g := jm.engine.GetState().(*game.Game)
-	me := g.Ents[jm.myGid]
+	me := jm.ent(jm.myGid)
 	if me == nil {
 		base.Warn().Printf("Darn, I don't exist")
 		return runtime.Nil
 	}
-	angle := pos.Regular().Sub(me.Pos()).Angle()
-	jm.engine.ApplyEvent(game.Move{jm.myGid, angle, 1.0})
+	angle := pos.Regular().Sub(me.Pos).Angle()
+	jm.send(game.Move{Gid: jm.myGid, Angle: angle, Magnitude: 1.0})
 	return runtime.Nil
 }
 
 func (jm *JotaModule) Turn(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
 	jm.controller.angle = vs[0].Float()
-	jm.engine.ApplyEvent(game.Move{jm.myGid, jm.controller.angle, jm.controller.acc})
+	jm.send(game.Move{Gid: jm.myGid, Angle: jm.controller.angle, Magnitude: jm.controller.acc})
 	return runtime.Nil
 }
 
 func (jm *JotaModule) UseAbility(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
-	jm.engine.ApplyEvent(game.UseAbility{
+	jm.send(game.UseAbility{
 		Gid:     jm.myGid,
 		Index:   int(vs[0].Int()),
 		Button:  vs[1].Float(),
@@ -297,33 +509,34 @@ func (jm *JotaModule) UseAbility(vs ...runtime.Val) runtime.Val {
 
 func (jm *JotaModule) NearestEnt(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
-	jm.engine.Pause()
-	defer jm.engine.Unpause()
-	g := jm.engine.GetState().(*game.Game)
-	me := g.Ents[jm.myGid]
+	s := jm.snapshot()
+	if s == nil {
+		return runtime.Nil
+	}
+	me := s.Ents[jm.myGid]
 	if me == nil {
 		return runtime.Nil
 	}
-	var closest game.Ent
+	var closest *game.EntSnapshot
 	dist := 1e9
-	for _, ent := range g.Ents {
+	for _, gid := range s.Order {
+		ent := s.Ents[gid]
 		if ent == me {
 			continue
 		}
-		if closest == nil {
+		if d := ent.Pos.Sub(me.Pos).Mag2(); closest == nil || d < dist {
 			closest = ent
-		} else if closest.Pos().Sub(me.Pos()).Mag2() < dist {
-			dist = closest.Pos().Sub(me.Pos()).Mag2()
+			dist = d
 		}
 	}
 	if closest == nil {
 		return runtime.Nil
 	}
-	return jm.newEnt(closest.Id())
+	return jm.newEnt(closest.Gid)
 }
 
 type entDistSlice struct {
-	ents []game.Ent
+	ents []*game.EntSnapshot
 	dist []float64
 }
 
@@ -336,73 +549,130 @@ func (eds *entDistSlice) Swap(i, j int) {
 
 func (jm *JotaModule) ControlPoints(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
-	jm.engine.Pause()
-	defer jm.engine.Unpause()
-	g := jm.engine.GetState().(*game.Game)
 	obj := runtime.NewObject()
-	count := 0
-	for _, ent := range g.Ents {
-		if cp, ok := ent.(*game.ControlPoint); ok {
-			obj.Set(runtime.Number(count), jm.newEnt(cp.Id()))
-			count++
-		}
+	s := jm.snapshot()
+	if s == nil {
+		return obj
+	}
+	for i, gid := range s.ControlPoints {
+		obj.Set(runtime.Number(i), jm.newEnt(gid))
 	}
 	return obj
 }
 
 func (jm *JotaModule) NearbyEnts(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
-	jm.engine.Pause()
-	defer jm.engine.Unpause()
-	g := jm.engine.GetState().(*game.Game)
-	me := g.Ents[jm.myGid]
 	obj := runtime.NewObject()
+	s := jm.snapshot()
+	if s == nil {
+		return obj
+	}
+	me := s.Ents[jm.myGid]
 	if me == nil {
 		return obj
 	}
 
-	ents := g.EntsInRange(me.Pos(), me.Stats().Vision())
+	ents := s.EntsInRange(me.Pos, me.Vision)
 	var eds entDistSlice
 	for _, ent := range ents {
 		if ent == me {
 			continue
 		}
-		dist := ent.Pos().Sub(me.Pos()).Mag()
-		if dist > me.Stats().Vision() {
-			continue
-		}
-		if ent.Stats().Cloaking() > 0.9 && ent.Side() != me.Side() {
+		dist := ent.Pos.Sub(me.Pos).Mag()
+		if ent.Cloaking > 0.9 && ent.Side != me.Side {
 			continue
 		}
-		if g.ExistsLos(me.Pos(), ent.Pos()) {
+		if s.ExistsLos(me.Pos, ent.Pos) {
 			eds.ents = append(eds.ents, ent)
 			eds.dist = append(eds.dist, dist)
 		}
 	}
 	sort.Sort(&eds)
 	for i, ent := range eds.ents {
-		obj.Set(runtime.Number(i), jm.newEnt(ent.Id()))
+		obj.Set(runtime.Number(i), jm.newEnt(ent.Gid))
 	}
 	return obj
 }
 
 func (jm *JotaModule) PathDir(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
-	jm.engine.Pause()
-	pd := jm.engine.GetState().(*game.Game).PathingData()
-	jm.engine.Unpause()
 	src := vs[0].Native().(*agoraVec).Regular()
 	dst := vs[1].Native().(*agoraVec).Regular()
-	dir := pd.Dir(src, dst)
+	s := jm.snapshot()
+	if s == nil {
+		return runtime.Nil
+	}
+	dir := s.PathDir(src, dst)
 	return jm.newVec(dir.X, dir.Y)
 }
 
+// ManaNear returns the mana of each color, as Red, Green and Blue, within a
+// distance of a position.  The distance is optional and defaults to the
+// distance that mana can be drained from.
+func (jm *JotaModule) ManaNear(vs ...runtime.Val) runtime.Val {
+	jm.dieOnTerminated()
+	pos, ok := vs[0].Native().(*agoraVec)
+	if !ok {
+		base.Warn().Printf("Script called ManaNear with the wrong type: %T", vs[0].Native())
+		return runtime.Nil
+	}
+	s := jm.snapshot()
+	if s == nil {
+		return runtime.Nil
+	}
+	dist := s.MaxDrainDistance()
+	if len(vs) > 1 {
+		dist = vs[1].Float()
+	}
+	mana := s.ManaNear(pos.Regular(), dist)
+	obj := runtime.NewObject()
+	obj.Set(runtime.String("Red"), runtime.Number(mana[game.ColorRed]))
+	obj.Set(runtime.String("Green"), runtime.Number(mana[game.ColorGreen]))
+	obj.Set(runtime.String("Blue"), runtime.Number(mana[game.ColorBlue]))
+	return obj
+}
+
+// CanSee returns true if there is line of sight between its two arguments,
+// each of which can be an ent or a position.
+func (jm *JotaModule) CanSee(vs ...runtime.Val) runtime.Val {
+	jm.dieOnTerminated()
+	s := jm.snapshot()
+	if s == nil {
+		return runtime.Bool(false)
+	}
+	a, ok := jm.toPos(s, vs[0])
+	if !ok {
+		return runtime.Bool(false)
+	}
+	b, ok := jm.toPos(s, vs[1])
+	if !ok {
+		return runtime.Bool(false)
+	}
+	return runtime.Bool(s.ExistsLos(a, b))
+}
+
+// toPos returns the position of v, which should be an ent or a vec.
+func (jm *JotaModule) toPos(s *game.Snapshot, v runtime.Val) (linear.Vec2, bool) {
+	switch t := v.(type) {
+	case *agoraVec:
+		return t.Regular(), true
+	case *agoraEnt:
+		ent := s.Ents[t.gid]
+		if ent == nil {
+			return linear.Vec2{}, false
+		}
+		return ent.Pos, true
+	}
+	base.Warn().Printf("Script used a %T as a position", v)
+	return linear.Vec2{}, false
+}
+
 func (jm *JotaModule) Param(vs ...runtime.Val) runtime.Val {
 	jm.dieOnTerminated()
-	jm.paramsMutex.Lock()
-	defer jm.paramsMutex.Unlock()
+	jm.ai.paramsMutex.Lock()
+	defer jm.ai.paramsMutex.Unlock()
 	paramName := vs[0].String()
-	value, ok := jm.params[paramName]
+	value, ok := jm.ai.params[paramName]
 	if !ok {
 		return runtime.Nil
 	}
@@ -425,9 +695,9 @@ func (jm *JotaModule) Param(vs ...runtime.Val) runtime.Val {
 	}
 }
 
-func (jm *JotaModule) setParam(name string, value interface{}) {
-	jm.paramsMutex.Lock()
-	defer jm.paramsMutex.Unlock()
+func (ai *GameAi) SetParam(name string, value interface{}) {
+	ai.paramsMutex.Lock()
+	defer ai.paramsMutex.Unlock()
 
 	// NOTE: The list of supported types here should match the list in
 	// JotaModule.Param()
@@ -442,7 +712,7 @@ func (jm *JotaModule) setParam(name string, value interface{}) {
 		base.Error().Printf("Tried to specify a parameter with an unexpected type: %T", value)
 		return
 	}
-	jm.params[name] = value
+	ai.params[name] = value
 }
 
 func (jm *JotaModule) newVec(x, y float64) *agoraVec {
@@ -492,69 +762,3 @@ func (v *agoraVec) sub(args ...runtime.Val) runtime.Val {
 func (v *agoraVec) angle(args ...runtime.Val) runtime.Val {
 	return runtime.Number(v.Regular().Angle())
 }
-
-type GameAi struct {
-	jm *JotaModule
-}
-
-func (ai *GameAi) Start() {
-	if ai.jm == nil {
-		return
-	}
-	ctx := runtime.NewCtx(getGlobalJotaResolver(), new(compiler.Compiler))
-	ctx.RegisterNativeModule(new(stdlib.TimeMod))
-	ctx.RegisterNativeModule(&LogModule{})
-	ctx.RegisterNativeModule(ai.jm)
-	mod, err := ctx.Load(ai.jm.name)
-	if err != nil {
-		base.Error().Printf("Error compiling script: %v", err)
-		return
-	}
-	go func() {
-		for {
-			_, err := mod.Run()
-			if err.Error() == "module terminated" {
-				return
-			}
-			base.Error().Printf("Error running script: %v", err)
-		}
-	}()
-}
-func (ai *GameAi) SetParam(name string, value interface{}) {
-	if ai.jm == nil {
-		return
-	}
-	ai.jm.setParam(name, value)
-}
-func (ai *GameAi) Stop() {
-	if ai.jm == nil {
-		return
-	}
-}
-func (ai *GameAi) Terminate() {
-	if ai.jm == nil {
-		return
-	}
-	ai.jm.terminated = true
-}
-
-func init() {
-	game.RegisterAiMaker(Maker)
-}
-
-func Maker(name string, engine *cgf.Engine, gid game.Gid) game.Ai {
-	if !engine.IsHost() {
-		// Scripts should only run on the host engine
-		return &GameAi{}
-	}
-	ai := GameAi{
-		jm: &JotaModule{
-			engine:        engine,
-			myGid:         gid,
-			name:          name,
-			params:        make(map[string]interface{}),
-			gidToAgoraEnt: make(map[game.Gid]*agoraEnt),
-		},
-	}
-	return &ai
-}
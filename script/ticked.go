@@ -0,0 +1,224 @@
+package script
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/agora/runtime"
+	"github.com/runningwild/jota/base"
+	"github.com/runningwild/jota/game"
+	"time"
+)
+
+// A ticked script still runs in its own goroutine, but only while the game is
+// waiting for it in Tick.  It runs until it sleeps, or until it has called
+// maxTickedCalls jota functions, and then waits to be ticked again.  Sleeping
+// is measured in frames rather than in real time, so how long the game takes
+// to think has no effect on what the script does.  A script is stopped for
+// making too many calls rather than for taking too long, so what it does in a
+// tick doesn't depend on the clock.  A script that loops without calling jota
+// functions would hold up the game forever though, so Tick only waits for
+// hungTickTime before giving up on it.  Slow ticks are logged so that the
+// script can be found.
+
+// Most jota functions a ticked script can call in a single frame.
+const maxTickedCalls = 1000
+
+type ticker struct {
+	// Frame the script is being ticked on, and the frame it's waiting for.
+	frame int
+	wake  int
+
+	// Jota functions called and events sent since the script was last resumed.
+	calls  int
+	events []game.Event
+
+	// Set when the script returns, along with the error it returned if any.
+	finished bool
+	err      error
+
+	// Tick resumes the script through resume and then waits for it on yield.
+	resume chan struct{}
+	yield  chan struct{}
+}
+
+func makeTicker() *ticker {
+	return &ticker{
+		resume: make(chan struct{}),
+		yield:  make(chan struct{}),
+	}
+}
+
+// Tick runs the script until it waits for a later frame, and returns the
+// events it sent.  The script is started, or restarted after failing or
+// changing, here.
+func (ai *GameAi) Tick(s *game.Snapshot) []game.Event {
+	if !ai.ticked {
+		return nil
+	}
+	switch ai.Status().State {
+	case game.AiFinished, game.AiTerminated:
+		return nil
+	}
+	if ai.deps != nil && ai.deps.stale() {
+		if ai.jm != nil {
+			ai.jm.halt()
+			ai.jm = nil
+		}
+		ai.deps = nil
+		ai.restartFrame = s.Frame
+		ai.reloaded()
+	}
+	if ai.isHung() {
+		return nil
+	}
+	if ai.jm == nil {
+		if s.Frame < ai.restartFrame || !ai.startTicked(s.Frame) {
+			return nil
+		}
+	}
+	jm := ai.jm
+	t := jm.ticker
+	if s.Frame < t.wake {
+		return nil
+	}
+	t.frame = s.Frame
+	t.calls = 0
+	t.events = nil
+	jm.current = s
+	start := time.Now()
+	t.resume <- struct{}{}
+	timeout := time.NewTimer(hungTickTime)
+	select {
+	case <-t.yield:
+		timeout.Stop()
+	case <-timeout.C:
+		// The script's goroutine is left running, it stops once it calls a jota
+		// function since jm is halted.  ai.deps is kept so that the script is
+		// started again when it changes.
+		jm.halt()
+		ai.jm = nil
+		ai.hang(fmt.Errorf("ran for more than %v on frame %d without yielding", hungTickTime, s.Frame))
+		return nil
+	}
+	if elapsed := time.Since(start); elapsed > slowTickTime {
+		base.Warn().Printf("Script %s took %v to run on frame %d", ai.path(), elapsed, s.Frame)
+	}
+	switch {
+	case t.err != nil:
+		ai.jm = nil
+		ai.tickedFailed(s.Frame, t.err)
+	case t.finished:
+		ai.jm = nil
+		ai.finished()
+	}
+	return t.events
+}
+
+// startTicked compiles the script and starts it waiting for its first tick.
+// Returns false if it couldn't be compiled.
+func (ai *GameAi) startTicked(frame int) bool {
+	jm := ai.newModule()
+	ai.deps = newScriptDeps(getGlobalJotaResolver())
+	mod, err := ai.load(jm, ai.deps)
+	if err != nil {
+		ai.tickedFailed(frame, err)
+		return false
+	}
+	ai.jm = jm
+	ai.runFrame = frame
+	ai.setState(game.AiRunning)
+	go jm.runTicked(mod)
+	return true
+}
+
+func (ai *GameAi) tickedFailed(frame int, err error) {
+	ai.restartFrame = frame + ai.failed(err, frame-ai.runFrame)
+}
+
+// runTicked runs the script once, starting on its first tick.
+func (jm *JotaModule) runTicked(mod runtime.Module) {
+	t := jm.ticker
+	select {
+	case <-t.resume:
+	case <-jm.stop:
+		return
+	}
+	err := runScript(mod)
+	if err == nil {
+		t.finished = true
+	} else {
+		t.err = err
+	}
+	select {
+	case t.yield <- struct{}{}:
+	case <-jm.stop:
+	}
+}
+
+// wait gives control back to Tick until the script is ticked on frame or
+// later.  Returns false if the script was stopped while waiting.
+func (jm *JotaModule) wait(frame int) bool {
+	t := jm.ticker
+	t.wake = frame
+	select {
+	case t.yield <- struct{}{}:
+	case <-jm.stop:
+		return false
+	}
+	select {
+	case <-t.resume:
+		return true
+	case <-jm.stop:
+		return false
+	}
+}
+
+// timeModule replaces agora's time module.  Scripts are only ever stopped while
+// they call jota functions or sleep, so Sleep stops as soon as the script is
+// terminated, and ticked scripts sleep for frames rather than real time.
+type timeModule struct {
+	ctx *runtime.Ctx
+	ob  runtime.Object
+	jm  *JotaModule
+}
+
+func (tm *timeModule) ID() string {
+	return "time"
+}
+func (tm *timeModule) SetCtx(ctx *runtime.Ctx) {
+	tm.ctx = ctx
+}
+
+func (tm *timeModule) Run(_ ...runtime.Val) (v runtime.Val, err error) {
+	defer runtime.PanicToError(&err)
+	if tm.ob == nil {
+		tm.ob = runtime.NewObject()
+		tm.ob.Set(runtime.String("Sleep"), runtime.NewNativeFunc(tm.ctx, "time.Sleep", tm.Sleep))
+	}
+	return tm.ob, nil
+}
+
+// Sleep waits for the specified number of milliseconds.  Ticked scripts
+// always wait until at least the next frame.
+func (tm *timeModule) Sleep(vs ...runtime.Val) runtime.Val {
+	jm := tm.jm
+	jm.dieOnTerminated()
+	ms := vs[0].Int()
+	if jm.ticker == nil {
+		jm.setAsleep()
+		select {
+		case <-time.After(time.Duration(ms) * time.Millisecond):
+		case <-jm.stop:
+			panic(errTerminated)
+		}
+		jm.setAwake()
+		return runtime.Nil
+	}
+	frames := int((ms + game.FrameMs - 1) / game.FrameMs)
+	if frames < 1 {
+		frames = 1
+	}
+	if !jm.wait(jm.ticker.frame + frames) {
+		panic(errTerminated)
+	}
+	return runtime.Nil
+}
@@ -1,6 +1,12 @@
+// +build nographics
+
+// The server binary is a dedicated host that can run on machines without a
+// display.  Build it with the nographics tag:
+//   go build --tags nographics ./server
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/runningwild/cgf"
 	_ "github.com/runningwild/jota/ability"
@@ -9,22 +15,237 @@ import (
 	"github.com/runningwild/jota/base"
 	_ "github.com/runningwild/jota/effects"
 	"github.com/runningwild/jota/game"
+	"github.com/runningwild/jota/lan"
 	_ "github.com/runningwild/jota/script"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 )
 
+// SetupComplete is ignored if someone stopped being ready before it was
+// applied, so if setup is still running this long after starting the game it
+// is started again once everyone is ready.
+const startRetryDelay = 3 * time.Second
+
+// Config contains everything needed to run a dedicated server.  It can be
+// loaded from a json file with -config, any flags that are explicitly set on
+// the command line take precedence over values in that file.
+type Config struct {
+	DataDir string
+	Port    int
+	Name    string
+
+	// Name of the file in DataDir/rooms that will be played.
+	Room string
+
+	// Name of the game mode, like "onslaught".
+	Mode string
+
+	// Random seed for the game, if zero a seed is chosen when the game starts.
+	Seed int64
+
+	// If positive, no more than this many players may join.
+	MaxPlayers int
+
+	// The game starts automatically once MinPlayers have joined, everyone is
+	// ready, and StartDelay seconds have passed without anyone joining, leaving
+	// or changing whether they are ready.  If MinPlayers is zero the game only
+	// starts when a player starts it.
+	MinPlayers int
+	StartDelay float64
+
+	// If set, a replay of the game is recorded to this file.
+	Record string
+
+	// Address the game is announced to on the LAN, if empty it isn't announced.
+	LanTarget string
+
+	// If true Ais are run with the game, so that a match with the same seed and
+	// the same players always plays out the same way.
+	DeterministicAi bool
+}
+
+func defaultConfig() Config {
+	return Config{
+		DataDir:    "../data",
+		Port:       20007,
+		Name:       "thunderball",
+		Room:       "basic.json",
+		Mode:       "onslaught",
+		MinPlayers: 2,
+		StartDelay: 10,
+		LanTarget:  lan.DefaultTarget,
+	}
+}
+
+// loadConfig builds the config from the defaults, then the config file if one
+// was specified, then any flags that were explicitly set.
+func loadConfig() (Config, error) {
+	config := defaultConfig()
+	var flagConfig Config
+	configPath := flag.String("config", "", "Path to a json config file.")
+	flag.StringVar(&flagConfig.DataDir, "data", config.DataDir, "Path to the data directory.")
+	flag.IntVar(&flagConfig.Port, "port", config.Port, "Port to host on.")
+	flag.StringVar(&flagConfig.Name, "name", config.Name, "Name of the hosted game.")
+	flag.StringVar(&flagConfig.Room, "room", config.Room, "Room file, relative to the rooms directory.")
+	flag.StringVar(&flagConfig.Mode, "mode", config.Mode, "Game mode.")
+	flag.Int64Var(&flagConfig.Seed, "seed", config.Seed, "Random seed, 0 picks one when the game starts.")
+	flag.IntVar(&flagConfig.MaxPlayers, "max-players", config.MaxPlayers, "Maximum number of players, 0 is unlimited.")
+	flag.IntVar(&flagConfig.MinPlayers, "min-players", config.MinPlayers, "Players required before auto-starting, 0 never auto-starts.")
+	flag.Float64Var(&flagConfig.StartDelay, "start-delay", config.StartDelay, "Seconds to wait after min-players have joined before starting.")
+	flag.StringVar(&flagConfig.Record, "record", config.Record, "File to record a replay to.")
+	flag.StringVar(&flagConfig.LanTarget, "lan-target", config.LanTarget, "Address to announce the game to, empty disables announcing.")
+	flag.BoolVar(&flagConfig.DeterministicAi, "deterministic-ai", config.DeterministicAi, "Run Ais with the game so that matches with the same seed play out the same.")
+	flag.Parse()
+
+	if *configPath != "" {
+		err := base.LoadJson(*configPath, &config)
+		if err != nil {
+			return config, fmt.Errorf("Unable to load config '%s': %v", *configPath, err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "data":
+			config.DataDir = flagConfig.DataDir
+		case "port":
+			config.Port = flagConfig.Port
+		case "name":
+			config.Name = flagConfig.Name
+		case "room":
+			config.Room = flagConfig.Room
+		case "mode":
+			config.Mode = flagConfig.Mode
+		case "seed":
+			config.Seed = flagConfig.Seed
+		case "max-players":
+			config.MaxPlayers = flagConfig.MaxPlayers
+		case "min-players":
+			config.MinPlayers = flagConfig.MinPlayers
+		case "start-delay":
+			config.StartDelay = flagConfig.StartDelay
+		case "record":
+			config.Record = flagConfig.Record
+		case "lan-target":
+			config.LanTarget = flagConfig.LanTarget
+		case "deterministic-ai":
+			config.DeterministicAi = flagConfig.DeterministicAi
+		}
+	})
+	return config, nil
+}
+
 func main() {
-	base.SetDatadir("../data")
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	base.SetDatadir(config.DataDir)
+	defer base.CloseLog()
+	base.Log().Printf("Server config: %+v", config)
+
 	g := game.MakeGame()
-	engine, err := cgf.NewHostEngine(g, 17, "", 20007, nil, nil)
+	if g.RoomIndex(config.Room) == -1 {
+		fmt.Printf("Unable to find room '%s' in %s\n", config.Room, filepath.Join(config.DataDir, "rooms"))
+		return
+	}
+	if !game.HasMode(config.Mode) {
+		fmt.Printf("Unknown mode '%s'\n", config.Mode)
+		return
+	}
+	g.Setup.Room = config.Room
+	g.Setup.Mode = config.Mode
+	g.Setup.MaxPlayers = config.MaxPlayers
+	g.Setup.DeterministicAi = config.DeterministicAi
+	if config.Record != "" {
+		err := g.StartRecording(config.Record)
+		if err != nil {
+			fmt.Printf("Unable to record: %v\n", err)
+			return
+		}
+	}
+	engine, err := cgf.NewHostEngine(g, game.FrameMs, "", config.Port, base.EmailCrashReport, base.Log())
 	if err != nil {
 		fmt.Printf("Unable to create engine: %v\n", err)
 		return
 	}
-	err = cgf.Host(20007, "thunderball")
+	defer engine.Kill()
+	err = cgf.Host(config.Port, config.Name)
 	if err != nil {
 		fmt.Printf("Unable to host: %v\n", err)
 		return
 	}
-	fmt.Printf("%v\n", engine)
-	select {}
+	fmt.Printf("Hosting '%s' on port %d\n", config.Name, config.Port)
+	if config.LanTarget != "" {
+		announcer, err := lan.AnnounceEngine(config.LanTarget, engine, config.Name, config.Port)
+		if err != nil {
+			fmt.Printf("Unable to announce on the LAN: %v\n", err)
+		} else {
+			defer announcer.Close()
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	ticker := time.Tick(time.Millisecond * 100)
+	lastCount := -1
+	lastNotReady := -1
+	var lastChange time.Time
+	var startSent time.Time
+	for {
+		select {
+		case sig := <-sigs:
+			base.Log().Printf("Got %v, shutting down.", sig)
+			engine.Pause()
+			err := engine.GetState().(*game.Game).StopRecording()
+			engine.Unpause()
+			if err != nil {
+				base.Error().Printf("Unable to finish recording: %v", err)
+			}
+			fmt.Printf("Shutting down.\n")
+			return
+
+		case <-ticker:
+			engine.Pause()
+			g := engine.GetState().(*game.Game)
+			if g.Setup != nil && !startSent.IsZero() && time.Since(startSent) >= startRetryDelay {
+				base.Warn().Printf("The game didn't start, trying again once everyone is ready")
+				startSent = time.Time{}
+			}
+			if g.Setup != nil && startSent.IsZero() && config.MinPlayers > 0 {
+				count := len(g.Setup.EngineIds)
+				notReady := g.Setup.NotReady()
+				if count != lastCount || notReady != lastNotReady {
+					lastCount = count
+					lastNotReady = notReady
+					lastChange = time.Now()
+					base.Log().Printf("%d player(s) joined, %d not ready", count, notReady)
+				}
+				delay := time.Duration(config.StartDelay * float64(time.Second))
+				if count >= config.MinPlayers && notReady == 0 && time.Since(lastChange) >= delay {
+					seed := config.Seed
+					if seed == 0 {
+						seed = time.Now().UnixNano()
+					}
+					base.Log().Printf("Starting game with %d players and seed %d", count, seed)
+					engine.ApplyEvent(game.SetupComplete{Seed: seed})
+					startSent = time.Now()
+				}
+			}
+			if g.Result != nil {
+				// The server only hosts a single match.
+				fmt.Printf("Match over, winner: side %d (%s), scores: %v\n", g.Result.Winner, g.Result.Reason, g.Result.Scores)
+				err := g.StopRecording()
+				engine.Unpause()
+				if err != nil {
+					base.Error().Printf("Unable to finish recording: %v", err)
+				}
+				return
+			}
+			engine.Unpause()
+		}
+	}
 }
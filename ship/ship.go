@@ -0,0 +1,22 @@
+package ship
+
+import (
+	"github.com/runningwild/jota/base"
+	"github.com/runningwild/jota/stats"
+)
+
+// A Ship is what a player flies around in, all of a player's stats come from
+// their ship.
+type Ship struct {
+	Defname string
+	*ShipDef
+}
+
+type ShipDef struct {
+	Name    string
+	Texture base.Path
+	Stats   stats.Base
+
+	// Number of frames it takes to repair this ship after it is destroyed.
+	RepairFrames int
+}
@@ -0,0 +1,276 @@
+// Package sim runs matches without a window or an engine so that they can be
+// driven programmatically, for example for balance runs or for checking that
+// abilities still behave the way they are supposed to.  It works with the
+// nographics build tag.
+//
+// base.SetDatadir() must be called before making a Match.
+//
+// Since there is no engine no scripts are run, so control points never spawn
+// creeps and all players must be controlled through Move and UseAbility.
+package sim
+
+import (
+	"fmt"
+	_ "github.com/runningwild/jota/ability"
+	_ "github.com/runningwild/jota/ability/control_point"
+	_ "github.com/runningwild/jota/ability/creep"
+	"github.com/runningwild/jota/base"
+	_ "github.com/runningwild/jota/effects"
+	"github.com/runningwild/jota/game"
+	"github.com/runningwild/jota/stats"
+)
+
+type Player struct {
+	Side int
+
+	// Name of the champion, as specified in its json file.
+	Champ string
+
+	// Name of the ship, as specified in its json file.  If empty the first ship
+	// is used.
+	Ship string
+}
+
+type Config struct {
+	// Name of the file in the rooms directory to play in.
+	Room string
+
+	// Name of the game mode, if empty the default mode is used.
+	Mode string
+
+	Players []Player
+	Seed    int64
+}
+
+// A Death is recorded whenever an ent is removed from the game after dying.
+type Death game.DeathRecord
+
+// A Capture is recorded whenever a control point becomes controlled by a side.
+type Capture struct {
+	Frame int
+	Gid   game.Gid
+	Side  int
+}
+
+type Match struct {
+	Game *game.Game
+
+	// Everything that has happened since the match started, in order.
+	Deaths   []Death
+	Captures []Capture
+
+	// Total health lost by each ent.  Any healing done in the same frame is
+	// subtracted.
+	DamageTaken map[game.Gid]float64
+
+	// Total damage dealt by each ent, taken from the damage history of the ents
+	// it damaged.  Damage that nobody was responsible for isn't counted.
+	DamageDealt map[game.Gid]float64
+
+	players []game.Gid
+
+	// Number of entries in Game.Deaths that have already been copied to Deaths.
+	deaths int
+
+	// State of every ent as of the end of the previous frame.
+	prev map[game.Gid]entState
+}
+
+type entState struct {
+	health     float64
+	controlled bool
+
+	// The ent's damage history, by source and ability.
+	damage map[damageKey]stats.DamageRecord
+}
+
+type damageKey struct {
+	source  string
+	ability string
+}
+
+// MakeMatch sets up a game as specified by config and completes setup.  Players
+// are referred to by their index in config.Players.
+func MakeMatch(config Config) (*Match, error) {
+	if base.GetDataDir() == "" {
+		return nil, fmt.Errorf("Must call base.SetDatadir() before making a Match.")
+	}
+	g := game.MakeGame()
+	if g.RoomIndex(config.Room) == -1 {
+		return nil, fmt.Errorf("No room named '%s'.", config.Room)
+	}
+	g.Setup.Room = config.Room
+	if config.Mode != "" {
+		if !game.HasMode(config.Mode) {
+			return nil, fmt.Errorf("No mode named '%s'.", config.Mode)
+		}
+		g.Setup.Mode = config.Mode
+	}
+
+	var ids []int64
+	for i := range config.Players {
+		ids = append(ids, int64(i+1))
+	}
+	game.SetupSetEngineIds{EngineIds: ids}.Apply(g)
+	for i, player := range config.Players {
+		champ := -1
+		for j := range g.Champs {
+			if g.Champs[j].Name == player.Champ {
+				champ = j
+			}
+		}
+		if champ == -1 {
+			return nil, fmt.Errorf("No champ named '%s'.", player.Champ)
+		}
+		ship := 0
+		if player.Ship != "" {
+			ship = -1
+			for j := range g.Ships {
+				if g.Ships[j].Name == player.Ship {
+					ship = j
+				}
+			}
+			if ship == -1 {
+				return nil, fmt.Errorf("No ship named '%s'.", player.Ship)
+			}
+		}
+		game.SetupChangeSides{EngineId: ids[i], Side: player.Side}.Apply(g)
+		game.SetupChampSelect{EngineId: ids[i], Champ: champ}.Apply(g)
+		game.SetupShipSelect{EngineId: ids[i], Ship: ship}.Apply(g)
+		game.SetupReady{EngineId: ids[i], Ready: true}.Apply(g)
+	}
+	game.SetupComplete{Seed: config.Seed}.Apply(g)
+
+	m := &Match{
+		Game:        g,
+		DamageTaken: make(map[game.Gid]float64),
+		DamageDealt: make(map[game.Gid]float64),
+		prev:        make(map[game.Gid]entState),
+	}
+	for _, id := range ids {
+		m.players = append(m.players, g.Engines[id].PlayerGid)
+	}
+	m.snapshot()
+	return m, nil
+}
+
+// Over returns true once the match has ended, after which Game.Result holds the
+// outcome and nothing moves any more.
+func (m *Match) Over() bool {
+	return m.Game.Result != nil
+}
+
+// Step advances the game by n frames.
+func (m *Match) Step(n int) {
+	for i := 0; i < n; i++ {
+		m.Game.Think()
+		m.update()
+	}
+}
+
+// Move applies a Move event to the specified player on the next frame.
+func (m *Match) Move(player int, angle, magnitude float64) {
+	game.Move{Gid: m.players[player], Angle: angle, Magnitude: magnitude}.Apply(m.Game)
+}
+
+// UseAbility applies a UseAbility event to the specified player on the next
+// frame.
+func (m *Match) UseAbility(player, index int, button float64, trigger bool) {
+	game.UseAbility{Gid: m.players[player], Index: index, Button: button, Trigger: trigger}.Apply(m.Game)
+}
+
+// LaunchShip chooses which ship in the specified player's hangar is launched
+// the next time they lose their ship.
+func (m *Match) LaunchShip(player, hangar int) {
+	game.LaunchShip{EngineId: int64(player + 1), Hangar: hangar}.Apply(m.Game)
+}
+
+func (m *Match) PlayerGid(player int) game.Gid {
+	return m.players[player]
+}
+
+// Player returns the ent for the specified player, or nil if they are dead.
+func (m *Match) Player(player int) game.Ent {
+	return m.Game.Ents[m.players[player]]
+}
+
+// ControlPoints returns all control points, ordered by Gid.
+func (m *Match) ControlPoints() []*game.ControlPoint {
+	var cps []*game.ControlPoint
+	m.Game.DoForEnts(func(gid game.Gid, ent game.Ent) {
+		if cp, ok := ent.(*game.ControlPoint); ok {
+			cps = append(cps, cp)
+		}
+	})
+	return cps
+}
+
+// Controlled returns the number of control points currently controlled by
+// side.
+func (m *Match) Controlled(side int) int {
+	count := 0
+	for _, cp := range m.ControlPoints() {
+		if cp.Controlled && cp.Controller == side {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *Match) snapshot() {
+	for gid := range m.prev {
+		delete(m.prev, gid)
+	}
+	m.Game.DoForEnts(func(gid game.Gid, ent game.Ent) {
+		state := entState{
+			health: ent.Stats().HealthCur(),
+			damage: make(map[damageKey]stats.DamageRecord),
+		}
+		for _, record := range ent.Stats().DamageHistory() {
+			state.damage[damageKey{record.Source, record.Ability}] = record
+		}
+		if cp, ok := ent.(*game.ControlPoint); ok {
+			state.controlled = cp.Controlled
+		}
+		m.prev[gid] = state
+	})
+}
+
+// update compares the game against the state from the previous frame and
+// records anything that happened in between.
+func (m *Match) update() {
+	// The frame that just finished.
+	frame := m.Game.Frame - 1
+	base.DoOrdered(m.prev, func(a, b game.Gid) bool { return a < b }, func(gid game.Gid, prev entState) {
+		ent, ok := m.Game.Ents[gid]
+		if !ok {
+			return
+		}
+		if health := ent.Stats().HealthCur(); health < prev.health {
+			m.DamageTaken[gid] += prev.health - health
+		}
+		if cp, ok := ent.(*game.ControlPoint); ok && cp.Controlled && !prev.controlled {
+			m.Captures = append(m.Captures, Capture{frame, gid, cp.Controller})
+		}
+	})
+	// Dead ents aren't removed until the next frame, so this sees the damage
+	// from killing blows as well.
+	m.Game.DoForEnts(func(gid game.Gid, ent game.Ent) {
+		prev := m.prev[gid].damage
+		for _, record := range ent.Stats().DamageHistory() {
+			amt := record.Amt
+			// A record that wasn't added to for longer than DamageHistoryThinks
+			// was dropped from the history, so this one was started over.
+			if p, ok := prev[damageKey{record.Source, record.Ability}]; ok && record.Last-p.Last <= stats.DamageHistoryThinks {
+				amt -= p.Amt
+			}
+			if amt > 0 {
+				m.DamageDealt[game.Gid(record.Source)] += amt
+			}
+		}
+	})
+	for ; m.deaths < len(m.Game.Deaths); m.deaths++ {
+		m.Deaths = append(m.Deaths, Death(m.Game.Deaths[m.deaths]))
+	}
+	m.snapshot()
+}
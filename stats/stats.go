@@ -33,6 +33,15 @@ type Base struct {
 	// Maximum vision distance, for technical reasons this value will always be
 	// reported as LosPlayerHorizon if it ever exceeds LosPlayerHorizon.
 	Vision float64
+
+	// Armor is a flat amount subtracted from every instance of damage of each
+	// kind.  Most damage is applied a little bit every frame, so this should be
+	// small.
+	Armor PerKind
+
+	// Resistance is the fraction of damage of each kind, after armor, that is
+	// ignored.  1.0 is immune, negative values take extra damage.
+	Resistance PerKind
 }
 
 type DamageKind int
@@ -43,9 +52,67 @@ const (
 	DamageCrushing
 )
 
+// PerKind holds a value for each DamageKind.
+type PerKind struct {
+	Fire     float64
+	Acid     float64
+	Crushing float64
+}
+
+func (p PerKind) Get(kind DamageKind) float64 {
+	switch kind {
+	case DamageFire:
+		return p.Fire
+	case DamageAcid:
+		return p.Acid
+	case DamageCrushing:
+		return p.Crushing
+	}
+	return 0
+}
+
+func (p *PerKind) Set(kind DamageKind, value float64) {
+	switch kind {
+	case DamageFire:
+		p.Fire = value
+	case DamageAcid:
+		p.Acid = value
+	case DamageCrushing:
+		p.Crushing = value
+	}
+}
+
+func (p PerKind) Add(q PerKind) PerKind {
+	return PerKind{
+		Fire:     p.Fire + q.Fire,
+		Acid:     p.Acid + q.Acid,
+		Crushing: p.Crushing + q.Crushing,
+	}
+}
+
 type Damage struct {
 	Kind DamageKind
 	Amt  float64
+
+	// Gid of the ent responsible for this damage and the name of the ability it
+	// used, so that kills can be credited.  Source is empty if nobody is
+	// responsible.
+	Source  string
+	Ability string
+}
+
+// How long damage stays in an Inst's history after it was last dealt.
+const DamageHistoryThinks = 60 * 10
+
+// A DamageRecord is the total damage an Inst has taken from one source with one
+// ability.
+type DamageRecord struct {
+	Source  string
+	Ability string
+	Amt     float64
+
+	// Value of Inst.Thinks() the last time this damage was dealt.
+	Last int
 }
 
 type Condition interface {
@@ -53,7 +120,8 @@ type Condition interface {
 	// only temporarily.
 	ModifyBase(base Base) Base
 
-	// Called any time the entity with this condition takes damage.
+	// Called any time the entity with this condition takes damage, after armor
+	// and resistance have been applied.
 	ModifyDamage(damage Damage) Damage
 
 	// Run every frame, this damage is applied to the entity with this condition.
@@ -64,6 +132,12 @@ type inst struct {
 	Base       Base
 	Dynamic    Dynamic
 	Conditions []Condition
+
+	// Number of times Think has been called.
+	Thinks int
+
+	// Ordered from least to most recently dealt.
+	History []DamageRecord
 }
 
 type Inst struct {
@@ -115,20 +189,78 @@ func (s Inst) Vision() float64 {
 	return vision
 }
 
+func (s Inst) Armor(kind DamageKind) float64 {
+	return math.Max(0, s.ModifyBase(s.inst.Base).Armor.Get(kind))
+}
+func (s Inst) Resistance(kind DamageKind) float64 {
+	return math.Min(1, s.ModifyBase(s.inst.Base).Resistance.Get(kind))
+}
+
 func (s *Inst) SetHealth(health float64) {
 	s.inst.Dynamic.Health = health
 }
+
+// ApplyDamage reduces damage by armor, then by resistance, then passes it
+// through each condition's ModifyDamage in the order the conditions were
+// applied.  Armor and resistance include any changes made by ModifyBase.
 func (s *Inst) ApplyDamage(damage Damage) {
+	damage.Amt -= s.Armor(damage.Kind)
+	if damage.Amt <= 0 {
+		return
+	}
+	damage.Amt *= 1 - s.Resistance(damage.Kind)
 	for _, cond := range s.inst.Conditions {
 		damage = cond.ModifyDamage(damage)
 	}
 	if damage.Amt > 0 {
 		s.inst.Dynamic.Health -= damage.Amt
+		s.inst.recordDamage(damage)
+	}
+}
+
+func (s *inst) recordDamage(damage Damage) {
+	if damage.Source == "" {
+		return
+	}
+	record := DamageRecord{Source: damage.Source, Ability: damage.Ability}
+	for i := range s.History {
+		if s.History[i].Source == damage.Source && s.History[i].Ability == damage.Ability {
+			record = s.History[i]
+			s.History = append(s.History[:i], s.History[i+1:]...)
+			break
+		}
 	}
+	record.Amt += damage.Amt
+	record.Last = s.Thinks
+	s.History = append(s.History, record)
+}
+
+// Thinks returns the number of times Think has been called.
+func (s Inst) Thinks() int {
+	return s.inst.Thinks
+}
+
+// DamageHistory returns all damage taken within the last DamageHistoryThinks,
+// combined by source and ability, ordered from least to most recently dealt.
+func (s Inst) DamageHistory() []DamageRecord {
+	return append([]DamageRecord(nil), s.inst.History...)
 }
 func (s *Inst) ApplyCondition(condition Condition) {
 	s.inst.Conditions = append(s.inst.Conditions, condition)
 }
+
+// Conditions returns every condition applied since the last call to Think, in
+// the order they were applied.
+func (s Inst) Conditions() []Condition {
+	return append([]Condition(nil), s.inst.Conditions...)
+}
+
+// SetConditions replaces the applied conditions.  Conditions are usually also
+// referenced from elsewhere, and decoding an Inst gives it its own copy of
+// each of them, so this is used to point it back at the originals.
+func (s *Inst) SetConditions(conditions []Condition) {
+	s.inst.Conditions = conditions
+}
 func (s *Inst) Think() {
 	// Allow any conditions to apply damage
 	for _, condition := range s.inst.Conditions {
@@ -136,6 +268,10 @@ func (s *Inst) Think() {
 	}
 	s.inst.Conditions = s.inst.Conditions[0:0]
 	s.inst.Base.Cloaking = 0.0
+	s.inst.Thinks++
+	for len(s.inst.History) > 0 && s.inst.Thinks-s.inst.History[0].Last > DamageHistoryThinks {
+		s.inst.History = s.inst.History[1:]
+	}
 }
 
 func Make(base Base) Inst {